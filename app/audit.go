@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/schema"
+)
+
+// Operations recorded in the audit trail
+const (
+	AuditCreate = "CREATE"
+	AuditUpdate = "UPDATE"
+	AuditDelete = "DELETE"
+)
+
+// AuditFlag is set in Flags by callbacks.RegisterAudit, the history routes reply 501 without it
+const AuditFlag = "AUDIT"
+
+// ControllerKey is the key of the context holding the name of the controller handling the request
+const ControllerKey = "controller"
+
+// AuditUser returns the user recorded in the audit trail for the writes of the request
+var AuditUser = SessionUsername
+
+// ControllerName returns the name of the controller handling the request, empty outside of the registered routes
+func ControllerName(c *gin.Context) string {
+	return c.GetString(ControllerKey)
+}
+
+// AuditKey returns the primary keys of the record as stored in AuditEntry.PRIMARY_KEYS
+func AuditKey(ctx context.Context, modelSchema *schema.Schema, val reflect.Value) string {
+	val = reflect.Indirect(val)
+	keys := make([]any, len(modelSchema.PrimaryFields))
+	for i, field := range modelSchema.PrimaryFields {
+		value, _ := field.ValueOf(ctx, val)
+		keys[i] = indirect(value)
+	}
+	data, _ := json.Marshal(keys)
+	return string(data)
+}
+
+func indirect(value any) any {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return nil
+	}
+	return val.Interface()
+}
+
+// AuditEntry records a write of a record (see callbacks.RegisterAudit). CONTEXT is the table of the model, PRIMARY_KEYS
+// the JSON array of its primary keys and CHANGES the JSON object of the changed fields with their old and new values.
+type AuditEntry struct {
+	ID_AUDIT     int       `gorm:"primaryKey;type:int"`
+	CONTEXT      string    `gorm:"type:nvarchar(50);not null;index:IX_AUDIT_RECORD"`
+	PRIMARY_KEYS string    `gorm:"type:nvarchar(200);not null;index:IX_AUDIT_RECORD"`
+	OPERATION    string    `gorm:"type:varchar(10);not null"`
+	USERNAME     string    `gorm:"type:nvarchar(100)"`
+	CONTROLLER   string    `gorm:"type:nvarchar(100)"`
+	CHANGES      string    `gorm:"type:ntext"`
+	CREATED_AT   time.Time `gorm:"not null"`
+}
+
+func (AuditEntry) TableName() string {
+	return "AUDIT"
+}
+
+func (AuditEntry) SkipAudit() bool {
+	return true
+}
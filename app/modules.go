@@ -28,6 +28,10 @@ func (s *KeySet) Add(key string) {
 	s.keys[key] = struct{}{}
 }
 
+func (s *KeySet) Remove(key string) {
+	delete(s.keys, key)
+}
+
 func (s *KeySet) Clear() {
 	s.keys = map[string]struct{}{}
 }
@@ -3,6 +3,7 @@ package app
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -21,6 +22,10 @@ func (s SessionModel) TableName() string {
 	return "SESSIONS"
 }
 
+func (s SessionModel) SkipAudit() bool {
+	return true
+}
+
 type Session struct {
 	properties map[string]interface{}
 	expiresAt  time.Time
@@ -172,3 +177,15 @@ func DeleteSession(key string) {
 func clearExpired() {
 	provider.clearExpired()
 }
+
+// SessionUsername returns the USERNAME property of the session of the request, empty if there's no session
+func SessionUsername(c *gin.Context) string {
+	if s, ok := c.Get("s"); ok {
+		if session, ok := s.(*Session); ok {
+			if owner := session.Get("USERNAME"); owner != nil {
+				return fmt.Sprint(owner)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const locationKey = "loc"
+
+/*
+RequestLocation returns the time zone of the request, read from the Timezone header or from the TIMEZONE property of
+the session, nil when neither is set or valid. The location is cached in the context.
+*/
+func RequestLocation(c *gin.Context) *time.Location {
+	if loc, ok := c.Get(locationKey); ok {
+		return loc.(*time.Location)
+	}
+	name := c.GetHeader("Timezone")
+	if name == "" {
+		if s, ok := c.Get("s"); ok {
+			if session, ok := s.(*Session); ok {
+				if tz := session.Get("TIMEZONE"); tz != nil {
+					name = fmt.Sprint(tz)
+				}
+			}
+		}
+	}
+	var loc *time.Location
+	if name != "" {
+		loc, _ = time.LoadLocation(name)
+	}
+	c.Set(locationKey, loc)
+	return loc
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"encoding/json"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+)
+
+// View is a named preset of the arguments of the list queries (see controller.ApplyView).
+// CONTEXT is the table of the model, the view is private when OWNER is set and shared otherwise.
+type View struct {
+	ID_VIEW    int    `gorm:"primaryKey;type:int"`
+	CONTEXT    string `gorm:"type:nvarchar(50);not null"`
+	NAME       string `gorm:"type:nvarchar(100);not null" validate:"required"`
+	OWNER      string `gorm:"type:nvarchar(100);not null;default:''"`
+	QUERY_ARGS string `gorm:"type:ntext"`
+}
+
+func (View) TableName() string {
+	return "VIEWS"
+}
+
+func (v View) Validate(c *gin.Context) message.Message {
+	if len(v.QUERY_ARGS) > 0 && !json.Valid([]byte(v.QUERY_ARGS)) {
+		return message.InvalidJSON(c)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package callbacks
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const auditBeforeKey = "audit:before"
+
+type auditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+/*
+RegisterAudit records the creates, updates and deletes of the models in app.AuditEntry, which must be migrated.
+The entries are written in the transaction of the write, the models implementing model.SkipAuditModel are excluded.
+The history routes of the controllers reply 501 Not Implemented until it is called.
+*/
+func RegisterAudit(db *gorm.DB, prefix string) {
+	app.Flags.Add(app.AuditFlag)
+	db.Callback().Create().After("gorm:create").Register(prefix+":audit_create", AuditCreateCallback)
+	db.Callback().Update().Before("gorm:update").Register(prefix+":audit_before_update", AuditBeforeCallback)
+	db.Callback().Update().After("gorm:update").Register(prefix+":audit_update", AuditUpdateCallback)
+	db.Callback().Delete().Before("gorm:delete").Register(prefix+":audit_before_delete", AuditBeforeCallback)
+	db.Callback().Delete().After("gorm:delete").Register(prefix+":audit_delete", AuditDeleteCallback)
+}
+
+func AuditCreateCallback(db *gorm.DB) {
+	if !audited(db) || db.RowsAffected == 0 {
+		return
+	}
+	entries := []app.AuditEntry{}
+	eachRecord(db.Statement.ReflectValue, func(row reflect.Value) {
+		entries = append(entries, auditEntry(db, app.AuditCreate, row, reflect.Value{}, row))
+	})
+	writeAudit(db, entries)
+}
+
+// AuditBeforeCallback reads the records affected by the update or delete, before they're written
+func AuditBeforeCallback(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	exprs := []clause.Expression{}
+	if where, ok := db.Statement.Clauses[clause.Where{}.Name()]; ok {
+		if w, ok := where.Expression.(clause.Where); ok {
+			exprs = append(exprs, w.Exprs...)
+		}
+	}
+	if db.Statement.ReflectValue.IsValid() && reflect.Indirect(db.Statement.ReflectValue).Kind() != reflect.Map {
+		if cond := primaryKeysCondition(db.Statement, db.Statement.ReflectValue); cond != nil {
+			exprs = append(exprs, cond)
+		}
+	}
+	if len(exprs) == 0 {
+		return
+	}
+	db.InstanceSet(auditBeforeKey, auditedRows(db, exprs))
+}
+
+func AuditUpdateCallback(db *gorm.DB) {
+	before, ok := auditBefore(db)
+	if !ok {
+		return
+	}
+	afterRows := auditedRows(db, []clause.Expression{primaryKeysCondition(db.Statement, before)})
+	after := map[string]reflect.Value{}
+	eachRecord(afterRows, func(row reflect.Value) {
+		after[app.AuditKey(db.Statement.Context, db.Statement.Schema, row)] = row
+	})
+	entries := []app.AuditEntry{}
+	eachRecord(before, func(row reflect.Value) {
+		if afterRow, ok := after[app.AuditKey(db.Statement.Context, db.Statement.Schema, row)]; ok {
+			if entry := auditEntry(db, app.AuditUpdate, row, row, afterRow); entry.CHANGES != "{}" {
+				entries = append(entries, entry)
+			}
+		}
+	})
+	writeAudit(db, entries)
+}
+
+func AuditDeleteCallback(db *gorm.DB) {
+	before, ok := auditBefore(db)
+	if !ok {
+		return
+	}
+	entries := []app.AuditEntry{}
+	eachRecord(before, func(row reflect.Value) {
+		entries = append(entries, auditEntry(db, app.AuditDelete, row, row, reflect.Value{}))
+	})
+	writeAudit(db, entries)
+}
+
+func audited(db *gorm.DB) bool {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil || len(db.Statement.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	if skip, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(model.SkipAuditModel); ok && skip.SkipAudit() {
+		return false
+	}
+	return true
+}
+
+func auditBefore(db *gorm.DB) (reflect.Value, bool) {
+	if !audited(db) || db.RowsAffected == 0 {
+		return reflect.Value{}, false
+	}
+	before, ok := db.InstanceGet(auditBeforeKey)
+	if !ok || before.(reflect.Value).Len() == 0 {
+		return reflect.Value{}, false
+	}
+	return before.(reflect.Value), true
+}
+
+// auditedRows reads the records of the model of the statement matching the conditions
+func auditedRows(db *gorm.DB, exprs []clause.Expression) reflect.Value {
+	rows := reflect.New(reflect.SliceOf(db.Statement.Schema.ModelType))
+	db.AddError(db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table).Clauses(clause.Where{Exprs: exprs}).Find(rows.Interface()).Error)
+	return rows.Elem()
+}
+
+func eachRecord(val reflect.Value, fn func(reflect.Value)) {
+	val = reflect.Indirect(val)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			eachRecord(val.Index(i), fn)
+		}
+	case reflect.Struct:
+		fn(val)
+	}
+}
+
+// auditEntry returns the entry of the write of the record, with the fields changed between before and after
+func auditEntry(db *gorm.DB, operation string, row, before, after reflect.Value) app.AuditEntry {
+	ctx := db.Statement.Context
+	changes := map[string]auditChange{}
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" || !field.Readable {
+			continue
+		}
+		var change auditChange
+		if before.IsValid() {
+			value, _ := field.ValueOf(ctx, before)
+			change.Old = indirect(value)
+		}
+		if after.IsValid() {
+			value, _ := field.ValueOf(ctx, after)
+			change.New = indirect(value)
+		}
+		if operation == app.AuditCreate && (change.New == nil || reflect.ValueOf(change.New).IsZero()) {
+			continue
+		}
+		if operation == app.AuditUpdate && reflect.DeepEqual(change.Old, change.New) {
+			continue
+		}
+		changes[field.Name] = change
+	}
+	data, _ := json.Marshal(changes)
+	return app.AuditEntry{
+		CONTEXT:      db.Statement.Schema.Table,
+		PRIMARY_KEYS: app.AuditKey(ctx, db.Statement.Schema, row),
+		OPERATION:    operation,
+		CHANGES:      string(data),
+		CREATED_AT:   time.Now(),
+	}
+}
+
+func indirect(value any) any {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return nil
+	}
+	return val.Interface()
+}
+
+func writeAudit(db *gorm.DB, entries []app.AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	if c, ok := db.Statement.Context.Value("gin").(*gin.Context); ok {
+		username, controllerName := app.AuditUser(c), app.ControllerName(c)
+		for i := range entries {
+			entries[i].USERNAME = username
+			entries[i].CONTROLLER = controllerName
+		}
+	}
+	db.AddError(db.Session(&gorm.Session{NewDB: true}).Create(&entries).Error)
+}
@@ -6,6 +6,7 @@ import (
 
 // Register registers all available callbacks to *gorm.DB
 func Register(db *gorm.DB, prefix string) {
+	RegisterSoftDelete(db, prefix)
 	RegisterRecursiveDelete(db, prefix)
 	RegisterCheckSkipDelete(db, prefix)
 	RegisterGlobalModelHooks(db, prefix)
@@ -19,12 +19,10 @@ func logError(hook app.Webhook, prefix string, err error) {
 
 func LoadWebhooks(db *gorm.DB) {
 	var modelWebhooks []app.Webhook
-	db.Raw(`
-		IF (EXISTS(SELECT * FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = 'dbo' AND TABLE_NAME = 'WEBHOOKS'))
-		BEGIN
-			SELECT * FROM WEBHOOKS WHERE TYPE IN ('AfterUpdate')
-		END
-	`).Scan(&modelWebhooks)
+	if !db.Migrator().HasTable(&app.Webhook{}) {
+		return
+	}
+	db.Where(map[string]any{"TYPE": []string{app.AfterUpdateHook}}).Find(&modelWebhooks)
 	for _, hook := range modelWebhooks {
 		app.AddModelHook(hook.CONTEXT, hook.TYPE, func(db *gorm.DB) {
 			c := db.Statement.Context.Value("gin").(*gin.Context)
@@ -2,10 +2,10 @@ package callbacks
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/controller"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
@@ -16,10 +16,15 @@ func RegisterRecursiveDelete(db *gorm.DB, prefix string) {
 }
 
 func RecursiveDeleteCallback(db *gorm.DB) {
-	if db.Error != nil || db.Statement.Model == nil {
+	// The relations of the soft deleted records are handled by SoftDeleteCallback before marking them
+	if db.Error != nil || db.Statement.Model == nil || softDeleteField(db) != nil {
 		return
 	}
+	deleteRelations(db, false)
+}
 
+// deleteRelations deletes the records related to the ones of the statement, only the soft deleted relations if soft
+func deleteRelations(db *gorm.DB, soft bool) {
 	val := db.Statement.ReflectValue
 
 	relations := []*schema.Relationship{}
@@ -33,11 +38,14 @@ func RecursiveDeleteCallback(db *gorm.DB) {
 
 RelLoop:
 	for _, rel := range relations {
+		// The relations of a soft deleted record are kept, unless they're soft deleted too
+		if soft && controller.SoftDeleteField(reflect.New(rel.FieldSchema.ModelType).Interface(), rel.FieldSchema) == nil {
+			continue
+		}
 		if !strings.HasPrefix(rel.FieldSchema.Table, "(") && rel.Field.Updatable {
 			if len(rel.FieldSchema.PrimaryFieldDBNames) == 0 {
 				continue
 			}
-			dest := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType)).Interface()
 			keySet := map[string]struct{}{}
 			for _, key := range rel.FieldSchema.PrimaryFieldDBNames {
 				keySet[key] = struct{}{}
@@ -59,17 +67,22 @@ RelLoop:
 			}
 			tx := db.Session(&gorm.Session{NewDB: true}).Select(keyArr).Table(rel.FieldSchema.Table)
 			exprs := []clause.Expression{}
+			var columns []string
+			var keys [][]any
 			conditions := rel.ToQueryConditions(db.Statement.Context, val)
 			for _, cond := range conditions {
 				if in, ok := cond.(clause.IN); ok {
+					if len(in.Values) == 0 {
+						return
+					}
+					// The keys are bound in chunks, composite keys can't use the IN clause in SQL Server
 					if cols, ok := in.Column.([]clause.Column); ok {
-						if len(in.Values) == 0 {
-							return
+						for _, col := range cols {
+							columns = append(columns, db.Statement.Quote(col))
 						}
-						if len(cols) > 1 {
-							keySet := map[string]any{}
-							var ks any = keySet
-							vals := in.Values[0].([]any)
+						for _, tuple := range in.Values {
+							vals := tuple.([]any)
+							key := make([]any, len(vals))
 							for i, val := range vals {
 								if reflect.TypeOf(val).Kind() == reflect.Ptr {
 									if reflect.ValueOf(val).IsNil() {
@@ -78,35 +91,37 @@ RelLoop:
 									}
 									val = reflect.ValueOf(val).Elem().Interface()
 								}
-								str := fmt.Sprint(val)
-								if i == len(vals)-1 {
-									current := ks.(map[string]struct{})
-									current[str] = struct{}{}
-								} else if i == len(vals)-2 {
-									current := ks.(map[string]any)
-									if _, ok := current[str]; !ok {
-										m := map[string]struct{}{}
-										ks.(map[string]any)[str] = m
-									}
-									ks = current[str]
-								} else {
-									current := ks.(map[string]any)
-									if _, ok := current[str]; !ok {
-										m := map[string]any{}
-										current[str] = m
-									}
-									ks = current[str]
-								}
+								key[i] = val
 							}
-							exprs = append(exprs, clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: keySetToStr(cols, keySet)}}})
-							continue
+							keys = append(keys, key)
+						}
+						continue
+					} else if col, ok := in.Column.(clause.Column); ok {
+						columns = []string{db.Statement.Quote(col)}
+						for _, val := range in.Values {
+							keys = append(keys, []any{val})
 						}
+						continue
 					}
 				}
 				exprs = append(exprs, cond)
 			}
-			if len(exprs) > 0 {
-				res := tx.Clauses(clause.Where{Exprs: exprs}).Scan(dest)
+			if len(exprs) == 0 && len(keys) == 0 {
+				db.AddError(errors.New("could not delete " + rel.FieldSchema.Name + " related to " + rel.Schema.Name))
+				return
+			}
+			chunks := controller.ChunkKeySet(keys)
+			if len(chunks) == 0 {
+				chunks = [][][]any{nil}
+			}
+			for _, chunk := range chunks {
+				chunkExprs := exprs
+				if chunk != nil {
+					query, args := controller.KeySetCondition(columns, chunk)
+					chunkExprs = append(append([]clause.Expression{}, exprs...), clause.Expr{SQL: query, Vars: args})
+				}
+				dest := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType)).Interface()
+				res := tx.Session(&gorm.Session{}).Clauses(clause.Where{Exprs: chunkExprs}).Scan(dest)
 				if res.Error != nil {
 					db.AddError(res.Error)
 					return
@@ -120,41 +135,7 @@ RelLoop:
 						return
 					}
 				}
-			} else {
-				db.AddError(errors.New("could not delete " + rel.FieldSchema.Name + " related to " + rel.Schema.Name))
-				return
 			}
 		}
 	}
 }
-
-func keySetToStr(cols []clause.Column, vals any) string {
-	result := ""
-	if len(cols) == 1 {
-		m := vals.(map[string]struct{})
-		var keys string
-		for v := range m {
-			keys += v + ","
-		}
-		keys = strings.TrimSuffix(keys, ",")
-		result += cols[0].Table + "." + cols[0].Name + " IN (" + keys + ")"
-	} else {
-		m := vals.(map[string]any)
-		if len(m) > 1 {
-			result += "("
-		}
-		first := true
-		for k, v := range m {
-			if first {
-				first = false
-			} else {
-				result += ") OR ("
-			}
-			result += cols[0].Table + "." + cols[0].Name + " = " + k + " AND " + keySetToStr(cols[1:], v)
-		}
-		if len(m) > 1 {
-			result += ")"
-		}
-	}
-	return result
-}
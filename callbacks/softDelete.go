@@ -0,0 +1,89 @@
+package callbacks
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/Datosystem/go_api_core/controller"
+	"github.com/Datosystem/go_api_core/dialect"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+func RegisterSoftDelete(db *gorm.DB, prefix string) {
+	db.Callback().Delete().Before("gorm:delete").Register(prefix+":soft_delete", SoftDeleteCallback)
+}
+
+type deletedAtKey struct{}
+
+// SoftDeleteCallback turns the deletes of the soft deleted models (see model.SoftDeleteModel) into updates, unless Unscoped
+func SoftDeleteCallback(db *gorm.DB) {
+	field := softDeleteField(db)
+	if field == nil || db.Statement.SQL.Len() > 0 {
+		return
+	}
+
+	stmt := db.Statement
+	cond := primaryKeysCondition(stmt, stmt.ReflectValue)
+	if _, ok := stmt.Clauses["WHERE"]; !ok && cond == nil && !db.AllowGlobalUpdate {
+		// Like gorm:delete, without conditions the whole table would be marked
+		db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	// The records deleted in cascade share the deletion time, so that they can be restored with the record
+	deletedAt, ok := stmt.Context.Value(deletedAtKey{}).(time.Time)
+	if !ok {
+		deletedAt = time.Now()
+		stmt.Context = context.WithValue(stmt.Context, deletedAtKey{}, deletedAt)
+	}
+	// The soft deleted relations are marked before the records, so a failure leaves them untouched
+	if db.Statement.Model != nil {
+		deleteRelations(db, true)
+		if db.Error != nil {
+			return
+		}
+	}
+	if cond != nil {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{cond}})
+	}
+	// The records already deleted keep their marker
+	if query, args := controller.NotDeletedCondition(dialect.For(db), reflect.New(stmt.Schema.ModelType).Interface(), stmt.Schema, stmt.Table); query != "" {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: query, Vars: args}}})
+	}
+	stmt.AddClause(clause.Set{{Column: clause.Column{Name: field.DBName}, Value: controller.DeletedValue(field, deletedAt)}})
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build("UPDATE", "SET", "WHERE")
+}
+
+// softDeleteField returns the marker of the soft deleted model of the statement, nil if the delete isn't soft
+func softDeleteField(db *gorm.DB) *schema.Field {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Unscoped {
+		return nil
+	}
+	return controller.SoftDeleteField(reflect.New(db.Statement.Schema.ModelType).Interface(), db.Statement.Schema)
+}
+
+// primaryKeysCondition returns the condition on the primary keys of the records of val, nil if they have none
+func primaryKeysCondition(stmt *gorm.Statement, val reflect.Value) clause.Expression {
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, val, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) == 0 {
+		return nil
+	}
+	if cols, ok := column.([]clause.Column); ok {
+		// Composite keys can't use the IN clause in SQL Server
+		columns := make([]string, len(cols))
+		for i, col := range cols {
+			columns[i] = stmt.Quote(col)
+		}
+		keys := make([][]any, len(values))
+		for i, val := range values {
+			keys[i] = val.([]any)
+		}
+		query, args := controller.KeySetCondition(columns, keys)
+		return clause.Expr{SQL: query, Vars: args}
+	}
+	return clause.IN{Column: column, Values: values}
+}
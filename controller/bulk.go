@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// BulkResult is the reply of the bulk deletes and updates, with the primary keys of the matched records
+type BulkResult struct {
+	DryRun bool             `json:"dryRun"`
+	Count  int              `json:"count"`
+	Keys   []map[string]any `json:"keys"`
+}
+
+/*
+HandleBulkDelete deletes the records matching the params v2 filter of the "p" query param and the default conditions.
+The number of matched records must be confirmed with the "count" query param, dryRun=1 only returns them.
+*/
+func HandleBulkDelete(c *gin.Context, db *gorm.DB, mdl any, config QueryMapConfig) {
+	bulkTransaction(c, db, mdl, config, func(tx *gorm.DB, modelSchema *schema.Schema, models []any, _ [][]any) error {
+		return deleteModels(tx, models, modelSchema)
+	})
+}
+
+/*
+HandleBulkUpdate sets the values of the body on the records matching the params v2 filter of the "p" query param
+and the default conditions. The number of matched records must be confirmed with the "count" query param,
+dryRun=1 only returns them. The integer versions of the versioned models (see model.VersionModel) are incremented.
+*/
+func HandleBulkUpdate(c *gin.Context, db *gorm.DB, mdl any, config QueryMapConfig) {
+	jsonData, _ := c.GetRawData()
+	values := map[string]any{}
+	LoadAndValidateMap(c, jsonData, values, reflect.TypeOf(mdl).Elem())
+	if c.IsAborted() {
+		return
+	}
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+	versionField := VersionField(mdl, modelSchema)
+	for name := range values {
+		// Only the columns can be set, the primary keys identify the records and the version is incremented
+		if field := modelSchema.LookUpField(name); field == nil || field.DBName == "" || field.PrimaryKey || !field.Updatable || field == versionField {
+			message.InvalidField(c, name).Abort(c)
+			return
+		}
+	}
+	if versionField != nil && !isRowVersion(versionField) {
+		values[versionField.Name] = gorm.Expr("? + 1", clause.Column{Name: versionField.DBName})
+	}
+
+	bulkTransaction(c, db, mdl, config, func(tx *gorm.DB, modelSchema *schema.Schema, models []any, keys [][]any) error {
+		columns := make([]string, len(modelSchema.PrimaryFields))
+		for i, field := range modelSchema.PrimaryFields {
+			columns[i] = modelSchema.Table + "." + dialect.For(tx).Quote(field.DBName)
+		}
+		for start := 0; start < len(keys); start += DefaultChunkSize {
+			end := min(start+DefaultChunkSize, len(keys))
+			query, args := KeySetCondition(columns, keys[start:end])
+			utx := tx.Session(&gorm.Session{NewDB: true}).Model(reflect.New(modelSchema.ModelType).Interface()).Where(query, args...)
+			if condMdl, ok := models[0].(model.ConditionsModel); ok {
+				query, args := condMdl.DefaultConditions(tx, modelSchema.Table)
+				if query != "" {
+					utx = utx.Where("("+query+")", args...)
+				}
+			}
+			if err := utx.Updates(values).Error; err != nil {
+				return ExposeSQLErr(c, err)
+			}
+		}
+		return nil
+	})
+}
+
+// bulkTransaction reads the records matching the filter and, unless dryRun=1, writes them with fn in a transaction
+func bulkTransaction(c *gin.Context, db *gorm.DB, mdl any, config QueryMapConfig, fn func(tx *gorm.DB, modelSchema *schema.Schema, models []any, keys [][]any) error) {
+	if c.IsAborted() {
+		return
+	}
+
+	// A missing filter would match the whole table
+	p := c.Query("p")
+	if p == "" {
+		message.MissingRequiredParameter(c, "p", "query").Abort(c)
+		return
+	}
+	result := BulkResult{DryRun: c.Query("dryRun") == "1", Keys: []map[string]any{}}
+	confirmed := -1
+	if !result.DryRun {
+		count := c.Query("count")
+		if count == "" {
+			message.MissingRequiredParameter(c, "count", "query").Abort(c)
+			return
+		}
+		var err error
+		if confirmed, err = strconv.Atoi(count); err != nil {
+			message.InvalidUrlParameter(c, "count").Abort(c)
+			return
+		}
+	}
+
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil || len(modelSchema.PrimaryFields) == 0 {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+	primaryNames := make([]string, len(modelSchema.PrimaryFields))
+	for i, field := range modelSchema.PrimaryFields {
+		primaryNames[i] = field.Name
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		args := QueryMapArgs{Sel: strings.Join(primaryNames, ","), P: p, Model: reflect.New(modelSchema.ModelType).Interface()}
+		if err := QueryMap(c, tx, &args, config); err != nil {
+			return err
+		}
+		result.Count = len(args.Result)
+		if !result.DryRun && result.Count != confirmed {
+			return message.BulkCountMismatch(c, confirmed, result.Count).Set("count", result.Count)
+		}
+
+		models := make([]any, len(args.Result))
+		keys := make([][]any, len(args.Result))
+		for i, row := range args.Result {
+			key := map[string]any{}
+			models[i] = reflect.New(modelSchema.ModelType).Interface()
+			keys[i] = make([]any, len(modelSchema.PrimaryFields))
+			for j, field := range modelSchema.PrimaryFields {
+				key[field.Name] = indirectValue(row[field.Name])
+				keys[i][j] = key[field.Name]
+				if err := field.Set(c, reflect.ValueOf(models[i]).Elem(), key[field.Name]); err != nil {
+					return err
+				}
+			}
+			result.Keys = append(result.Keys, key)
+		}
+		if result.DryRun || len(models) == 0 {
+			return nil
+		}
+		return fn(tx, modelSchema, models, keys)
+	})
+	if AbortIfError(c, err) {
+		return
+	}
+
+	LocalizeDatetimes(c, result.Keys)
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleBulkUpdateVersion(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testVersioned{}); err != nil {
+		t.Fatal(err)
+	}
+	records := []testVersioned{{ID: 1, NAME: "a", VERSION: 7}, {ID: 2, NAME: "a", VERSION: 3}, {ID: 3, NAME: "b", VERSION: 5}}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		versions []int64
+	}{
+		{"update", `{"NAME":"c"}`, http.StatusOK, []int64{8, 4, 5}},
+		{"version set", `{"VERSION":1}`, http.StatusUnprocessableEntity, []int64{8, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newTestContext(db, "/")
+			c.Request = httptest.NewRequest(http.MethodPatch, "/?count=2&p="+url.QueryEscape(`{"ID<=":2}`), strings.NewReader(tt.body))
+			HandleBulkUpdate(c, db, &testVersioned{}, QueryMapConfig{SkipValidation: true})
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			stored := []testVersioned{}
+			if err := db.Order("ID").Find(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			for i, record := range stored {
+				if record.VERSION != tt.versions[i] {
+					t.Errorf("record %d: got version %d, want %d", record.ID, record.VERSION, tt.versions[i])
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package controller
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +18,7 @@ import (
 	"github.com/Datosystem/go_api_core/datatypes"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/Datosystem/go_api_core/model"
+	"github.com/Datosystem/go_api_core/xlsx"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -51,7 +54,12 @@ type CRUDSController interface {
 	Post(c *gin.Context)
 	Patch(c *gin.Context)
 	PatchMany(c *gin.Context)
+	Put(c *gin.Context)
 	Delete(c *gin.Context)
+	DeleteMany(c *gin.Context)
+	Restore(c *gin.Context)
+	History(c *gin.Context)
+	Import(c *gin.Context)
 
 	CanImport() bool
 
@@ -72,6 +80,8 @@ type Controller struct {
 	BasePath string
 	Endpoint string
 	Routes   []Route
+	// Limits of the query cost of Get, GetOne and the bulk writes, DefaultQueryLimits if not set
+	Limits *QueryLimits
 }
 
 func (r Controller) NewModel() interface{} {
@@ -113,10 +123,14 @@ func (r Controller) GetEndpointPath() string {
 }
 
 func (r Controller) Get(c *gin.Context) {
-	HandleGet(c, c.MustGet("db").(*gorm.DB), map[string]interface{}{}, r.NewModel())
+	HandleGetConfig(c, c.MustGet("db").(*gorm.DB), map[string]interface{}{}, r.NewModel(), QueryMapConfig{Limits: r.Limits})
 }
 
 func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, model any) {
+	HandleGetConfig(c, db, primaries, model, QueryMapConfig{})
+}
+
+func HandleGetConfig(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, model any, config QueryMapConfig) {
 	args := QueryMapArgs{
 		Sel:       c.Query("sel"),
 		Rel:       c.Query("rel"),
@@ -125,11 +139,51 @@ func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, mo
 		PagStart:  c.Query("pagStart"),
 		PagEnd:    c.Query("pagEnd"),
 		Ord:       c.Query("ord"),
+		Group:     c.Query("group"),
+		Q:         c.Query("q"),
+		Rank:      c.Query("rank") == "1",
+		After:     c.Query("after"),
 		Primaries: primaries,
 		Model:     model,
 	}
-	err := QueryMap(c, db, &args, QueryMapConfig{})
-	if AbortIfError(c, err) {
+	_, args.Cursor = c.GetQuery("after")
+	if view := c.Query("view"); len(view) > 0 {
+		if msg := ApplyView(c, db, view, &args); msg != nil {
+			msg.Abort(c)
+			return
+		}
+	}
+	debug, msg := CheckDebug(c)
+	if msg != nil {
+		msg.Abort(c)
+		return
+	}
+	if debug {
+		config.Debug = &QueryDebug{}
+	}
+	if config.IncludeDeleted, msg = CheckIncludeDeleted(c, model); msg != nil {
+		msg.Abort(c)
+		return
+	}
+	// HEAD requests on lists only need the X-Total-Count header
+	args.CountOnly = len(primaries) == 0 && (c.Query("count") == "1" || c.Request.Method == http.MethodHead)
+	if args.CountOnly {
+		if AbortIfError(c, WithDebug(QueryMap(c, db, &args, config), config.Debug)) {
+			return
+		}
+		WritePaginationHeaders(c, &args)
+		if args.Debug != nil {
+			c.JSON(http.StatusOK, Response{Data: args.Count, Count: args.Count, Debug: args.Debug.Recorded()})
+		} else {
+			c.JSON(http.StatusOK, args.Count)
+		}
+		return
+	}
+	if c.Query("stream") == "1" && len(primaries) == 0 && CanStream(c.GetHeader("Accept")) {
+		StreamQueryMapResult(c, db, &args, config)
+		return
+	}
+	if AbortIfError(c, WithDebug(QueryMap(c, db, &args, config), config.Debug)) {
 		return
 	}
 	WriteQueryMapResult(c, &args)
@@ -137,26 +191,11 @@ func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, mo
 
 func WriteQueryMapResult(c *gin.Context, args *QueryMapArgs) {
 	if !c.IsAborted() {
-		c.Header("X-Total-Count", strconv.Itoa(int(args.Count)))
-		var link string
-		if ShouldPaginate(args.PagStart, args.PagEnd) {
-			limit := GetLimit(args.PagStart, args.PagEnd)
-			start := GetOffset(args.PagStart) + limit
-			end := start + limit
-			if int64(end) < args.Count {
-				var params []string
-				for key, values := range c.Request.URL.Query() {
-					if key == "pagStart" {
-						params = append(params, key+"="+strconv.Itoa(start))
-					} else if key == "pagEnd" {
-						params = append(params, key+"="+strconv.Itoa(end))
-					} else {
-						params = append(params, key+"="+strings.Join(values, "&"+key+"="))
-					}
-				}
-				link = c.FullPath() + "?" + strings.Join(params, "&")
-				c.Header("Link", link)
-			}
+		link := WritePaginationHeaders(c, args)
+		LocalizeDatetimes(c, args.Result)
+		if WriteConditionalHeaders(c, args) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
 		}
 		switch c.GetHeader("Accept") {
 		case "application/csv", "text/csv":
@@ -168,82 +207,23 @@ func WriteQueryMapResult(c *gin.Context, args *QueryMapArgs) {
 			// TODO: Manage the CSV in the correct order
 
 			var csvData [][]string
-			tmz := c.Request.Header.Get("Timezone")
-			var heading []string
-			for _, f := range args.Info.Fields {
-				heading = append(heading, f.Name)
-			}
-			for key := range args.Info.Nested {
-				heading = append(heading, key)
-			}
-			// for i := range heading {
-			// 	if strings.Contains(heading[i], "AS") {
-			// 		s := strings.Split(heading[i], "AS")
-			// 		heading[i] = strings.TrimSpace(s[len(s)-1])
-			// 	}
-			// }
 			l := len(args.Result)
 			if l > 0 {
 
-				csvData = append(csvData, heading)
+				csvData = append(csvData, CsvHeading(&args.Info))
 
 				for i := 0; i < l; i++ {
-					item := args.Result[i]
-					var row []string
-					for _, f := range args.Info.Fields {
-						r := reflect.ValueOf(item[f.Name])
-						if r.IsValid() && !r.IsZero() && !r.IsNil() {
-							t := reflect.Indirect(r)
-							if t.Type().Kind() == reflect.Ptr {
-								t = t.Elem()
-							}
-							f := t.Interface()
-							if f != nil && f != "" {
-								if date, ok := f.(datatypes.Date); ok {
-									row = append(row, time.Time(date).Format("02/01/2006"))
-								} else if datetime, ok := f.(datatypes.Datetime); ok {
-									if c.GetHeader("Only-Date") == "" {
-										loc, _ := time.LoadLocation(tmz)
-										row = append(row, time.Time(datetime).In(loc).Format("02/01/2006 15:04"))
-									} else {
-										row = append(row, time.Time(datetime).Format("02/01/2006"))
-									}
-								} else if _, ok := f.(datatypes.RoundedFloat); ok {
-									row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-								} else if _, ok := f.(float32); ok {
-									row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-								} else if _, ok := f.(float64); ok {
-									row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-								} else {
-									if _, ok := f.(string); ok {
-										row = append(row, fmt.Sprintf("%s", f))
-									} else {
-										row = append(row, fmt.Sprint(f))
-									}
-								}
-							} else {
-								row = append(row, "")
-							}
-						} else {
-							row = append(row, "")
-						}
-					}
-					for key := range args.Info.Nested {
-						data, err := json.Marshal(item[key])
-						if err != nil {
-							fmt.Println(err)
-						}
-						row = append(row, string(data))
-					}
-					csvData = append(csvData, row)
+					csvData = append(csvData, CsvRow(c, &args.Info, args.Result[i]))
 				}
 			}
 			if err := csv.NewWriter(c.Writer).WriteAll(csvData); err != nil {
 				AbortWithError(c, err)
 			}
+		case xlsx.ContentType:
+			WriteXlsx(c, QueryMapToXlsx(c, &args.Info, args.Result))
 		case "application/xml", "text/xml":
 			if reflect.TypeOf(args.Result).Name() == "" || len(c.Query("wrap")) > 0 {
-				c.XML(http.StatusOK, Response{Data: args.Result, Next: link, Count: args.Count})
+				c.XML(http.StatusOK, Response{Data: args.Result, Next: link, Cursor: args.NextCursor, Count: args.Count})
 			} else {
 				c.XML(http.StatusOK, args.Result)
 			}
@@ -253,8 +233,8 @@ func WriteQueryMapResult(c *gin.Context, args *QueryMapArgs) {
 				result = args.Result[0]
 				// TODO: It might be advisable to set Count to 1 in this situation
 			}
-			if len(c.Query("wrap")) > 0 {
-				c.JSON(http.StatusOK, Response{Data: result, Next: link, Count: args.Count})
+			if len(c.Query("wrap")) > 0 || args.Debug != nil {
+				c.JSON(http.StatusOK, Response{Data: result, Next: link, Cursor: args.NextCursor, Count: args.Count, Debug: args.Debug.Recorded()})
 			} else {
 				c.JSON(http.StatusOK, result)
 			}
@@ -262,6 +242,131 @@ func WriteQueryMapResult(c *gin.Context, args *QueryMapArgs) {
 	}
 }
 
+// WritePaginationHeaders sets the X-Total-Count and Link headers and returns the link to the next page
+func WritePaginationHeaders(c *gin.Context, args *QueryMapArgs) string {
+	c.Header("X-Total-Count", strconv.Itoa(int(args.Count)))
+	var link string
+	if args.Cursor {
+		if len(args.NextCursor) > 0 {
+			link = NextPageLink(c, map[string]string{"after": args.NextCursor})
+			c.Header("Link", link)
+		}
+	} else if ShouldPaginate(args.PagStart, args.PagEnd) {
+		limit := GetLimit(args.PagStart, args.PagEnd)
+		start := GetOffset(args.PagStart) + limit
+		end := start + limit
+		if int64(end) < args.Count {
+			link = NextPageLink(c, map[string]string{"pagStart": strconv.Itoa(start), "pagEnd": strconv.Itoa(end)})
+			c.Header("Link", link)
+		}
+	}
+	return link
+}
+
+func CsvHeading(info *ModelInfo) []string {
+	heading := outputFields(info)
+	heading = append(heading, nestedKeys(info)...)
+	// for i := range heading {
+	// 	if strings.Contains(heading[i], "AS") {
+	// 		s := strings.Split(heading[i], "AS")
+	// 		heading[i] = strings.TrimSpace(s[len(s)-1])
+	// 	}
+	// }
+	return heading
+}
+
+// outputFields returns the names of the selected fields, without the hidden ones, followed by the computed fields
+func outputFields(info *ModelInfo) []string {
+	names := []string{}
+	for _, f := range info.Fields {
+		if _, hidden := info.Hidden[f.Name]; !hidden && f.Name != fkAlias {
+			names = append(names, f.Name)
+		}
+	}
+	for _, f := range info.Computed {
+		if _, hidden := info.Hidden[f.Name]; !hidden {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// nestedKeys returns the sorted names of the nested relations, so that CSV columns are stable
+func nestedKeys(info *ModelInfo) []string {
+	keys := make([]string, 0, len(info.Nested))
+	for key := range info.Nested {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func CsvRow(c *gin.Context, info *ModelInfo, item map[string]any) []string {
+	loc := requestLocationOrUTC(c)
+	var row []string
+	for _, name := range outputFields(info) {
+		r := reflect.ValueOf(item[name])
+		if r.IsValid() && !r.IsZero() {
+			t := reflect.Indirect(r)
+			if t.Type().Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			f := t.Interface()
+			if f != nil && f != "" {
+				if date, ok := f.(datatypes.Date); ok {
+					row = append(row, time.Time(date).Format("02/01/2006"))
+				} else if datetime, ok := f.(datatypes.Datetime); ok {
+					if c.GetHeader("Only-Date") == "" {
+						row = append(row, time.Time(datetime).In(loc).Format("02/01/2006 15:04"))
+					} else {
+						row = append(row, time.Time(datetime).Format("02/01/2006"))
+					}
+				} else if _, ok := f.(datatypes.RoundedFloat); ok {
+					row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
+				} else if _, ok := f.(float32); ok {
+					row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
+				} else if _, ok := f.(float64); ok {
+					row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
+				} else {
+					if _, ok := f.(string); ok {
+						row = append(row, fmt.Sprintf("%s", f))
+					} else {
+						row = append(row, fmt.Sprint(f))
+					}
+				}
+			} else {
+				row = append(row, "")
+			}
+		} else {
+			row = append(row, "")
+		}
+	}
+	for _, key := range nestedKeys(info) {
+		if index := strings.LastIndex(key, "."); index != -1 {
+			key = key[index+1:]
+		}
+		data, err := json.Marshal(item[key])
+		if err != nil {
+			fmt.Println(err)
+		}
+		row = append(row, string(data))
+	}
+	return row
+}
+
+// NextPageLink returns the current request path with the query values replaced by the supplied ones
+func NextPageLink(c *gin.Context, replace map[string]string) string {
+	var params []string
+	for key, values := range c.Request.URL.Query() {
+		if val, ok := replace[key]; ok {
+			params = append(params, key+"="+val)
+		} else {
+			params = append(params, key+"="+strings.Join(values, "&"+key+"="))
+		}
+	}
+	return c.FullPath() + "?" + strings.Join(params, "&")
+}
+
 func WriteDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count int64) {
 	if !c.IsAborted() {
 		c.Header("X-Total-Count", strconv.Itoa(int(count)))
@@ -271,20 +376,11 @@ func WriteDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count
 			start := GetOffset(pagStart) + limit
 			end := start + limit
 			if int64(end) < count {
-				var params []string
-				for key, values := range c.Request.URL.Query() {
-					if key == "pagStart" {
-						params = append(params, key+"="+strconv.Itoa(start))
-					} else if key == "pagEnd" {
-						params = append(params, key+"="+strconv.Itoa(end))
-					} else {
-						params = append(params, key+"="+strings.Join(values, "&"+key+"="))
-					}
-				}
-				link = c.FullPath() + "?" + strings.Join(params, "&")
+				link = NextPageLink(c, map[string]string{"pagStart": strconv.Itoa(start), "pagEnd": strconv.Itoa(end)})
 				c.Header("Link", link)
 			}
 		}
+		LocalizeDatetimes(c, data)
 		switch c.GetHeader("Accept") {
 		case "application/csv", "text/csv":
 			c.Header("Content-Type", c.GetHeader("Accept")+"; charset=utf-8")
@@ -346,6 +442,8 @@ func WriteDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count
 			if err := csv.NewWriter(c.Writer).WriteAll(csvData); err != nil {
 				AbortWithError(c, err)
 			}
+		case xlsx.ContentType:
+			WriteXlsx(c, DataToXlsx(c, data))
 		case "application/xml", "text/xml":
 			if reflect.TypeOf(data).Name() == "" || len(c.Query("wrap")) > 0 {
 				c.XML(http.StatusOK, Response{Data: data, Next: link, Count: count})
@@ -368,7 +466,7 @@ func (r Controller) GetOne(c *gin.Context) {
 	if c.IsAborted() {
 		return
 	}
-	HandleGet(c, c.MustGet("db").(*gorm.DB), primaries, r.NewModel())
+	HandleGetConfig(c, c.MustGet("db").(*gorm.DB), primaries, r.NewModel(), QueryMapConfig{Limits: r.Limits})
 }
 
 func (r Controller) GetStructure(c *gin.Context) {
@@ -440,14 +538,25 @@ func (r Controller) Patch(c *gin.Context) {
 	modelType := r.GetModelType()
 	primaryFields := GetPrimaryFields(modelType)
 
+	switch c.ContentType() {
+	case MergePatchContentType, JSONPatchContentType:
+		PatchDocumentToDb(c, model, primaryFields, jsonData)
+		return
+	}
 	LoadModel(c, jsonData, model)
 	GetPathParams(c, model, primaryFields, model)
+	version := LoadVersion(c, model, jsonData)
 	LoadAndValidateMap(c, jsonData, jsonMap, modelType)
 	GetPathParams(c, model, primaryFields, &jsonMap)
-	UpdateToDb(c, model, jsonMap)
+	UpdateVersionToDb(c, model, jsonMap, version)
 }
 
 func (r Controller) PatchMany(c *gin.Context) {
+	if _, ok := c.GetQuery("p"); ok {
+		HandleBulkUpdate(c, c.MustGet("db").(*gorm.DB), r.NewModel(), QueryMapConfig{Limits: r.Limits})
+		return
+	}
+
 	modelSlice := r.NewSliceOfModel()
 	jsonMaps := []map[string]interface{}{}
 	jsonData, _ := c.GetRawData()
@@ -456,6 +565,7 @@ func (r Controller) PatchMany(c *gin.Context) {
 	LoadModel(c, jsonData, modelSlice)
 	LoadAndValidateMaps(c, jsonData, &jsonMaps, modelType)
 	ValidateMapsPrimaries(c, jsonMaps, GetPrimaryFields(modelType))
+	versions := LoadVersions(c, modelSlice, jsonData)
 	if c.IsAborted() {
 		return
 	}
@@ -479,7 +589,12 @@ func (r Controller) PatchMany(c *gin.Context) {
 			}
 		}
 
-		db.Session(&gorm.Session{FullSaveAssociations: true}).Transaction(func(tx *gorm.DB) error {
+		var versionField *schema.Field
+		if versions != nil {
+			versionField = VersionField(modelSliceVal.Index(0).Addr().Interface(), modelSchema)
+		}
+		conflict := -1
+		err = db.Session(&gorm.Session{FullSaveAssociations: true}).Transaction(func(tx *gorm.DB) error {
 			for i, values := range jsonMaps {
 				modelVal := modelSliceVal.Index(i).Addr()
 				e := DeleteRelations(c, tx, modelVal, modelSchema)
@@ -489,17 +604,34 @@ func (r Controller) PatchMany(c *gin.Context) {
 				if tx.Error != nil {
 					return tx.Error
 				}
-				res := tx.Model(modelVal.Interface()).Updates(values)
-				if res.Error != nil {
-					return res.Error
+				var version any
+				if versions != nil {
+					version = versions[i]
+				}
+				if e = updateVersioned(tx, modelVal.Interface(), values, versionField, version); e != nil {
+					if errors.Is(e, errVersionConflict) {
+						conflict = i
+					}
+					return e
 				}
 			}
 
 			return nil
 		})
+		if conflict != -1 {
+			WriteVersionConflict(c, c.MustGet("db").(*gorm.DB), modelSliceVal.Index(conflict).Addr().Interface())
+			return
+		} else if err != nil {
+			AbortWithError(c, err)
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, modelSlice)
+	WriteModelsResult(c, c.MustGet("db").(*gorm.DB), modelSlice)
+}
+
+func (r Controller) Put(c *gin.Context) {
+	HandleUpsert(c, c.MustGet("db").(*gorm.DB), r.GetModel(), GetPrimaryFields(r.GetModelType()))
 }
 
 func (r Controller) Delete(c *gin.Context) {
@@ -509,6 +641,26 @@ func (r Controller) Delete(c *gin.Context) {
 	DeleteFromDb(c, models)
 }
 
+func (r Controller) DeleteMany(c *gin.Context) {
+	HandleBulkDelete(c, c.MustGet("db").(*gorm.DB), r.NewModel(), QueryMapConfig{Limits: r.Limits})
+}
+
+func (r Controller) Restore(c *gin.Context) {
+	primaryFields := GetPrimaryFields(r.GetModelType())
+	models := []interface{}{}
+	PathParamsToModels(c, r.GetModelType(), primaryFields, &models)
+	RestoreFromDb(c, models)
+}
+
+func (r Controller) History(c *gin.Context) {
+	models := []interface{}{}
+	PathParamsToModels(c, r.GetModelType(), GetPrimaryFields(r.GetModelType()), &models)
+	if c.IsAborted() {
+		return
+	}
+	WriteHistory(c, models[0])
+}
+
 func (r *Controller) CanImport() bool {
 	return false
 }
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PrepareCursor makes the order of the root model usable for keyset pagination:
+// every order field must be a selected column and the primary keys are appended
+// as tie breakers so that the order is deterministic.
+// The returned slice contains the result keys of the order fields.
+func PrepareCursor(c *gin.Context, d dialect.Dialect, info *ModelInfo, ord string) ([]string, message.Message) {
+	if len(ord) == 0 {
+		info.Order = ""
+		info.OrderFields = []OrderField{}
+	}
+	for _, fld := range info.Schema.PrimaryFields {
+		found := false
+		for _, o := range info.OrderFields {
+			if o.Field == fld && o.Table == info.Table {
+				found = true
+				break
+			}
+		}
+		if !found {
+			info.OrderFields = append(info.OrderFields, OrderField{Name: fld.Name, Table: info.Table, Field: fld})
+			if len(info.Order) > 0 {
+				info.Order += ","
+			}
+			info.Order += info.Table + "." + d.Quote(fld.DBName)
+		}
+	}
+	if len(info.OrderFields) == 0 {
+		return nil, message.ManualPagination(c)
+	}
+
+	keys := make([]string, len(info.OrderFields))
+	for i, o := range info.OrderFields {
+		if o.Field == nil {
+			return nil, message.UnsupportedCursorOrder(c, o.Name)
+		}
+		search := o.Table + "." + d.Quote(o.Field.DBName)
+		for j, sel := range info.Select {
+			if asIndex := strings.LastIndex(sel, " AS "); asIndex != -1 {
+				sel = sel[:asIndex]
+			}
+			if sel == search {
+				keys[i] = info.Fields[j].Name
+				break
+			}
+		}
+		if keys[i] == "" {
+			return nil, message.UnsupportedCursorOrder(c, o.Name)
+		}
+	}
+	return keys, nil
+}
+
+// EncodeCursor returns the opaque token containing the order values of the row
+func EncodeCursor(row map[string]any, keys []string) string {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		values[i] = row[key]
+	}
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses the token generated by EncodeCursor, converting each value to the type of its order field.
+// The NULL values of the nullable order fields are returned as nil.
+func DecodeCursor(c *gin.Context, token string, info *ModelInfo) ([]any, message.Message) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, message.InvalidCursor(c)
+	}
+	raw := []json.RawMessage{}
+	if json.Unmarshal(data, &raw) != nil || len(raw) != len(info.OrderFields) {
+		return nil, message.InvalidCursor(c)
+	}
+	values := make([]any, len(raw))
+	for i, o := range info.OrderFields {
+		if string(raw[i]) == "null" {
+			continue
+		}
+		val := reflect.New(o.Field.FieldType)
+		if json.Unmarshal(raw[i], val.Interface()) != nil {
+			return nil, message.InvalidCursor(c)
+		}
+		values[i] = val.Elem().Interface()
+	}
+	return values, nil
+}
+
+// Seek filters the rows following the cursor values and limits the result to limit+1 rows,
+// the extra row is used to know if there is a next page.
+// The nil values match NULL, which are sorted as the database does (see dialect.Dialect.NullsFirst).
+func Seek(info *ModelInfo, values []any, limit int) func(*gorm.DB) *gorm.DB {
+	return func(d *gorm.DB) *gorm.DB {
+		if len(values) > 0 {
+			q := dialect.For(d)
+			branches := []string{}
+			args := []any{}
+			for i, o := range info.OrderFields {
+				query, branchArgs := seekAfter(q, o, values[i])
+				if query == "" {
+					// No row follows the NULL values sorted last
+					continue
+				}
+				for j := i - 1; j >= 0; j-- {
+					column := info.OrderFields[j].Table + "." + q.Quote(info.OrderFields[j].Field.DBName)
+					if values[j] == nil {
+						query = column + " IS NULL AND " + query
+					} else {
+						query = column + " = ? AND " + query
+						branchArgs = append([]any{values[j]}, branchArgs...)
+					}
+				}
+				branches = append(branches, "("+query+")")
+				args = append(args, branchArgs...)
+			}
+			if len(branches) == 0 {
+				d = d.Where("1 = 0")
+			} else {
+				d = d.Where("("+strings.Join(branches, " OR ")+")", args...)
+			}
+		}
+		return d.Limit(limit + 1)
+	}
+}
+
+// seekAfter returns the condition matching the values of the order field that follow value,
+// empty when no value follows it
+func seekAfter(d dialect.Dialect, o OrderField, value any) (string, []any) {
+	column := o.Table + "." + d.Quote(o.Field.DBName)
+	// Whether the NULL values come before the others in the direction of the order
+	nullsBefore := d.NullsFirst() != o.Desc
+	if value == nil {
+		if nullsBefore {
+			return column + " IS NOT NULL", nil
+		}
+		return "", nil
+	}
+	operator := " > ?"
+	if o.Desc {
+		operator = " < ?"
+	}
+	if nullsBefore {
+		return column + operator, []any{value}
+	}
+	return "(" + column + operator + " OR " + column + " IS NULL)", []any{value}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	modelSchema, err := schema.Parse(&testOrder{}, &sync.Map{}, schema.NamingStrategy{NoLowerCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &ModelInfo{Schema: modelSchema, OrderFields: []OrderField{
+		{Name: "NOTE", Field: modelSchema.LookUpField("NOTE")},
+		{Name: "ID", Field: modelSchema.LookUpField("ID")},
+	}}
+	note := "urgent"
+
+	tests := []struct {
+		name   string
+		token  string
+		values []any
+		fails  bool
+	}{
+		{"values", EncodeCursor(map[string]any{"NOTE": &note, "ID": 3}, []string{"NOTE", "ID"}), []any{"urgent", 3}, false},
+		{"NULL", EncodeCursor(map[string]any{"NOTE": nil, "ID": 4}, []string{"NOTE", "ID"}), []any{nil, 4}, false},
+		{"invalid base64", "!", nil, true},
+		{"invalid JSON", "bm90IGpzb24", nil, true},
+		{"wrong length", EncodeCursor(map[string]any{"ID": 4}, []string{"ID"}), nil, true},
+		{"wrong type", EncodeCursor(map[string]any{"NOTE": "a", "ID": "b"}, []string{"NOTE", "ID"}), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(nil, "/")
+			values, msg := DecodeCursor(c, tt.token, info)
+			if tt.fails {
+				if msg == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if msg != nil {
+				t.Fatal(msg)
+			}
+			for i, want := range tt.values {
+				if got := indirectValue(values[i]); got != want {
+					t.Errorf("value %d: got %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// The pages of a nullable order field must contain every row once
+func TestSeekSQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		ord string
+		ids []int
+	}{
+		{"NOTE", []int{2, 4, 1, 3}},
+		{"NOTE DESC", []int{1, 3, 2, 4}},
+		{"NOTE,AMOUNT DESC", []int{4, 2, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ord, func(t *testing.T) {
+			got := []int{}
+			after := ""
+			for page := 0; page < len(tt.ids)+1; page++ {
+				args := QueryMapArgs{Sel: "ID,NOTE,AMOUNT", Ord: tt.ord, Cursor: true, PagEnd: "1", After: after, Model: &testOrder{}}
+				c, _ := newTestContext(db, "/")
+				if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, ids(args.Result)...)
+				if args.Count != int64(len(tt.ids)) {
+					t.Errorf("got count %d, want %d", args.Count, len(tt.ids))
+				}
+				if after = args.NextCursor; after == "" {
+					break
+				}
+			}
+			if !equalInts(got, tt.ids) {
+				t.Errorf("got %v, want %v", got, tt.ids)
+			}
+		})
+	}
+}
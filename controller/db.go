@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/Datosystem/go_api_core/model"
 
@@ -18,16 +20,7 @@ import (
 	"gorm.io/gorm/schema"
 )
 
-type MSSqlError interface {
-	Error() string
-	SQLErrorClass() uint8
-	SQLErrorLineNo() int32
-	SQLErrorMessage() string
-	SQLErrorNumber() int32
-	SQLErrorProcName() string
-	SQLErrorServerName() string
-	SQLErrorState() uint8
-}
+type MSSqlError = dialect.MSSqlError
 
 func CreateToDb(c *gin.Context, db *gorm.DB, model interface{}, args ...string) {
 	if c.IsAborted() {
@@ -71,7 +64,7 @@ func CreateToDb(c *gin.Context, db *gorm.DB, model interface{}, args ...string)
 	}
 
 	if len(args) == 0 {
-		c.JSON(http.StatusOK, model)
+		WriteModelsResult(c, db, model)
 	}
 }
 
@@ -111,6 +104,11 @@ func CheckModelPermissions(c *gin.Context, modelVal reflect.Value, modelSchema *
 }
 
 func UpdateToDb(c *gin.Context, model interface{}, values any) {
+	UpdateVersionToDb(c, model, values, nil)
+}
+
+// UpdateVersionToDb updates the model as UpdateToDb, when version isn't nil only if it's still the version of the record
+func UpdateVersionToDb(c *gin.Context, model interface{}, values any, version any) {
 	if c.IsAborted() {
 		return
 	}
@@ -135,28 +133,160 @@ func UpdateToDb(c *gin.Context, model interface{}, values any) {
 		}
 	}
 
-	tx := db.Session(&gorm.Session{FullSaveAssociations: true, SkipDefaultTransaction: true}).Begin()
-	v := reflect.ValueOf(model)
-	err = DeleteRelations(c, tx, v, modelSchema)
-	if err != nil {
-		AbortWithError(c, err)
-		tx.Rollback()
+	err = db.Session(&gorm.Session{FullSaveAssociations: true, SkipDefaultTransaction: true}).Transaction(func(tx *gorm.DB) error {
+		return updateModel(c, tx, model, values, version, modelSchema)
+	})
+	if errors.Is(err, errVersionConflict) {
+		WriteVersionConflict(c, db, model)
+		return
+	} else if AbortIfError(c, err) {
 		return
 	}
+	WriteModelsResult(c, db, model)
+}
+
+// updateModel deletes the relations marked with $delete and updates the model, when version isn't nil only if it's
+// still the version of the record
+func updateModel(c *gin.Context, tx *gorm.DB, model any, values any, version any, modelSchema *schema.Schema) error {
+	if err := DeleteRelations(c, tx, reflect.ValueOf(model), modelSchema); err != nil {
+		return err
+	}
 	if tx.Error != nil {
-		AbortWithError(c, tx.Error)
-		tx.Rollback()
+		return tx.Error
+	}
+	var versionField *schema.Field
+	if version != nil {
+		versionField = VersionField(model, modelSchema)
+	}
+	return updateVersioned(tx, model, values, versionField, version)
+}
+
+/*
+WriteModelsResult replies with the written model or slice of models. When the sel or rel query params are set
+the records are re-read by primary keys through QueryMap, so the response is shaped as the one of HandleGet.
+The records are already written: if they can't be re-read (eg. hidden by the default conditions) the written
+models are returned instead.
+*/
+func WriteModelsResult(c *gin.Context, db *gorm.DB, model any) {
+	if c.IsAborted() {
 		return
 	}
-	tx = tx.Model(model).Updates(values)
-	if tx.Error != nil {
-		AbortWithError(c, tx.Error)
-		tx.Rollback()
+	writeModels := func() {
+		LocalizeDatetimes(c, model)
+		c.JSON(http.StatusOK, model)
+	}
+	if c.Query("sel") == "" && c.Query("rel") == "" {
+		writeModels()
+		return
+	}
+
+	modelSchema, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+	if err != nil || len(modelSchema.PrimaryFields) == 0 {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+
+	val := reflect.Indirect(reflect.ValueOf(model))
+	if val.Kind() != reflect.Slice {
+		primaries := map[string]any{}
+		for _, field := range modelSchema.PrimaryFields {
+			primaries[field.DBName], _ = field.ValueOf(c, val)
+		}
+		args := QueryMapArgs{Sel: c.Query("sel"), Rel: c.Query("rel"), Primaries: primaries, Model: reflect.New(modelSchema.ModelType).Interface()}
+		if err := QueryMap(c, db, &args, QueryMapConfig{}); err != nil || len(args.Result) == 0 {
+			if err != nil {
+				log.Println(err)
+			}
+			writeModels()
+			return
+		}
+		LocalizeDatetimes(c, args.Result[0])
+		c.JSON(http.StatusOK, args.Result[0])
 		return
-	} else {
-		tx.Commit()
 	}
-	c.JSON(http.StatusOK, model)
+
+	keys := make([][]any, val.Len())
+	for i := range keys {
+		item := reflect.Indirect(val.Index(i))
+		for _, field := range modelSchema.PrimaryFields {
+			value, _ := field.ValueOf(c, item)
+			keys[i] = append(keys[i], indirectValue(value))
+		}
+	}
+
+	// The rows of every chunk are read by their key tuples, then matched to the written keys
+	rows := map[string]map[string]any{}
+	unordered := []map[string]any{}
+	var matchable bool
+	for _, chunk := range ChunkKeySet(keys) {
+		args := QueryMapArgs{Sel: c.Query("sel"), Rel: c.Query("rel"), PrimaryKeys: chunk, Model: reflect.New(modelSchema.ModelType).Interface()}
+		if err := QueryMap(c, db, &args, QueryMapConfig{}); err != nil {
+			log.Println(err)
+			writeModels()
+			return
+		}
+		matchable = selectsPrimaries(dialect.For(db), &args.Info)
+		for _, row := range args.Result {
+			if matchable {
+				key := make([]any, len(modelSchema.PrimaryFields))
+				for j, field := range modelSchema.PrimaryFields {
+					key[j] = indirectValue(row[field.Name])
+				}
+				rows[stringifyKey(key)] = row
+			}
+			unordered = append(unordered, row)
+		}
+	}
+
+	result := unordered
+	if matchable {
+		result = []map[string]any{}
+		for _, key := range keys {
+			if row, ok := rows[stringifyKey(key)]; ok {
+				result = append(result, row)
+			}
+		}
+	}
+	if len(result) != len(keys) {
+		writeModels()
+		return
+	}
+	LocalizeDatetimes(c, result)
+	c.JSON(http.StatusOK, result)
+}
+
+// selectsPrimaries reports whether the columns of the primary keys of the model are selected with their names
+func selectsPrimaries(d dialect.Dialect, info *ModelInfo) bool {
+PrimaryLoop:
+	for _, field := range info.Schema.PrimaryFields {
+		column := info.Table + "." + d.Quote(field.DBName)
+		for i, f := range info.Fields {
+			sel := info.Select[i]
+			if asIndex := strings.LastIndex(sel, " AS "); asIndex != -1 {
+				sel = sel[:asIndex]
+			}
+			if f.Name == field.Name && sel == column {
+				continue PrimaryLoop
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// indirectValue dereferences the pointers, nil pointers are returned as nil
+func indirectValue(value any) any {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return nil
+	}
+	return val.Interface()
 }
 
 func DeleteFromDb(c *gin.Context, models []any) {
@@ -173,13 +303,26 @@ func DeleteFromDb(c *gin.Context, models []any) {
 		return
 	}
 
+	if err := deleteModels(tx, models, modelSchema); err != nil {
+		tx.Rollback()
+		AbortWithError(c, err)
+		return
+	}
+
+	tx.Commit()
+
+	c.Status(http.StatusOK)
+}
+
+// deleteModels deletes the models one by one, within their default conditions
+func deleteModels(tx *gorm.DB, models []any, modelSchema *schema.Schema) error {
 	for _, mdl := range models {
 		tx := tx.Session(&gorm.Session{SkipDefaultTransaction: true})
 
 		table := mdl.(model.TableModel).TableName()
 
 		if condMdl, ok := mdl.(model.ConditionsModel); ok {
-			query, args := condMdl.DefaultConditions(db, table)
+			query, args := condMdl.DefaultConditions(tx, table)
 			if query != "" {
 				tx = tx.Where("("+query+")", args...)
 			}
@@ -188,15 +331,10 @@ func DeleteFromDb(c *gin.Context, models []any) {
 		LoadForeignKeys(tx, reflect.ValueOf(mdl), modelSchema)
 		res := tx.Delete(mdl)
 		if res.Error != nil {
-			tx.Rollback()
-			AbortWithError(c, res.Error)
-			return
+			return res.Error
 		}
 	}
-
-	tx.Commit()
-
-	c.Status(http.StatusOK)
+	return nil
 }
 
 func DeleteRelations(c *gin.Context, db *gorm.DB, modelVal reflect.Value, modelSchema *schema.Schema) error {
@@ -437,22 +575,8 @@ func DeleteModels(db *gorm.DB, models interface{}) (err error) {
 }
 
 func ExposeSQLErr(c *gin.Context, err error) error {
-	if err != nil {
-		if mssqlerr, ok := err.(MSSqlError); ok {
-			switch mssqlerr.SQLErrorNumber() {
-
-			case 242, /* Invalid nvarchar conversion range */
-				245,  /* Cast failed */
-				2601, /* Unique constraint violation */
-				8114 /* Errore durante la conversione del tipo di dati da nvarchar a float. */ :
-				return message.FromError(http.StatusConflict, err)
-			}
-		} /* else if w := errors.Unwrap(err); w != nil {
-			if mssqlerr, ok := w.(MSSqlError); ok {
-				fmt.Println(mssqlerr.SQLErrorNumber())
-			}
-		}*/
-		return err
+	if err != nil && dialect.IsConflict(err) {
+		return message.FromError(http.StatusConflict, err)
 	}
-	return nil
+	return err
 }
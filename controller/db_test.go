@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testPair struct {
+	A     int `gorm:"primaryKey;autoIncrement:false"`
+	B     int `gorm:"primaryKey;autoIncrement:false"`
+	LABEL string
+}
+
+func (testPair) TableName() string {
+	return "PAIRS"
+}
+
+func TestWriteModelsResultCompositeKeys(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testPair{}); err != nil {
+		t.Fatal(err)
+	}
+	pairs := []testPair{{1, 1, "a"}, {1, 2, "b"}, {2, 1, "c"}, {2, 2, "d"}}
+	if err := db.Create(&pairs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	written := []testPair{{2, 2, "d"}, {1, 1, "a"}}
+	tests := []struct {
+		name    string
+		url     string
+		models  []testPair
+		want    []string
+		ordered bool
+	}{
+		// The other pairs of the same values must not be returned, the order is kept only when the keys are selected
+		{"keys selected", "/?sel=A,B,LABEL", written, []string{"d", "a"}, true},
+		{"keys not selected", "/?sel=LABEL", written, []string{"d", "a"}, false},
+		// The written models are returned when some can't be re-read
+		{"missing row", "/?sel=A,B", []testPair{{2, 2, "d"}, {3, 3, "e"}}, []string{"d", "e"}, true},
+		{"invalid sel", "/?sel=MISSING", written, []string{"d", "a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newTestContext(db, tt.url)
+			WriteModelsResult(c, db, &tt.models)
+
+			result := []struct{ LABEL string }{}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err, w.Body.String())
+			}
+			if len(result) != len(tt.want) {
+				t.Fatalf("got %v, want %v", result, tt.want)
+			}
+			labels := map[string]int{}
+			for i := range result {
+				labels[result[i].LABEL] = i
+			}
+			for i, label := range tt.want {
+				if index, ok := labels[label]; !ok || (tt.ordered && index != i) {
+					t.Errorf("got %v, want %v", result, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteModelsResultHidden(t *testing.T) {
+	db := newTestDB(t)
+	c, w := newTestContext(db, "/?sel=ID")
+	WriteModelsResult(c, db, &testActiveCustomer{ID: 3, NAME: "Gamma"})
+
+	result := testActiveCustomer{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	if result.NAME != "Gamma" {
+		t.Errorf("expected the written model, got %s", w.Body.String())
+	}
+}
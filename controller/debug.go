@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DebugPermission is the permission required by debug=1
+const DebugPermission = "DEBUG"
+
+// DebugQuery describes a query executed by QueryMap, Relation is the path of the nested relation (empty for the root)
+type DebugQuery struct {
+	Relation   string  `json:"relation"`
+	SQL        string  `json:"sql"`
+	Vars       []any   `json:"vars"`
+	Rows       int64   `json:"rows"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// QueryDebug collects the queries executed by QueryMap when set in QueryMapConfig
+type QueryDebug struct {
+	mu      sync.Mutex
+	Queries []DebugQuery
+}
+
+type debugKey struct{}
+
+type debugScope struct {
+	debug    *QueryDebug
+	relation string
+	// The last statement executed in the scope, gorm resets Statement.SQL after the execution
+	sql  string
+	vars []any
+}
+
+// debugLogger passes the statements to the debug scope of their context before they are logged
+type debugLogger struct {
+	logger.Interface
+}
+
+func (l debugLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return debugLogger{l.Interface.LogMode(level)}
+}
+
+func (l debugLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if ctx != nil && ctx.Value(debugKey{}) != nil {
+		// fc passes the statement to ParamsFilter before interpolating its variables
+		fc()
+	}
+	l.Interface.Trace(ctx, begin, fc, err)
+}
+
+func (l debugLogger) ParamsFilter(ctx context.Context, sql string, params ...any) (string, []any) {
+	if ctx != nil {
+		if scope, ok := ctx.Value(debugKey{}).(*debugScope); ok {
+			scope.debug.mu.Lock()
+			scope.sql, scope.vars = sql, append([]any{}, params...)
+			scope.debug.mu.Unlock()
+		}
+	}
+	if filter, ok := l.Interface.(gorm.ParamsFilter); ok {
+		return filter.ParamsFilter(ctx, sql, params...)
+	}
+	return sql, params
+}
+
+// CheckDebug reports whether the request asks for the debug informations, which requires DebugPermission.
+// The executed queries are returned in the Debug member of the JSON responses, wrapped as with wrap=1,
+// and in the debug property of the error messages; they aren't available in the other formats nor in the streams.
+func CheckDebug(c *gin.Context) (bool, message.Message) {
+	if c.Query("debug") != "1" {
+		return false, nil
+	}
+	if s, ok := c.Get("s"); ok {
+		if session, ok := s.(*app.Session); ok {
+			return true, session.Check(c, DebugPermission)
+		}
+	}
+	return true, message.InsufficientPermissions(c, DebugPermission)
+}
+
+// Recorded returns a copy of the collected queries, nil if debug is nil
+func (debug *QueryDebug) Recorded() []DebugQuery {
+	if debug == nil {
+		return nil
+	}
+	debug.mu.Lock()
+	defer debug.mu.Unlock()
+	return append([]DebugQuery{}, debug.Queries...)
+}
+
+// WithDebug adds the collected queries to the error as its debug property, when it's a message and debug is set
+func WithDebug(err error, debug *QueryDebug) error {
+	if msg, ok := err.(message.Message); ok && debug != nil {
+		msg.Set("debug", debug.Recorded())
+	}
+	return err
+}
+
+// withDebug returns the db recording its queries in debug under the relation path
+func withDebug(db *gorm.DB, debug *QueryDebug, relation string) *gorm.DB {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	log := db.Logger
+	if l, ok := log.(debugLogger); ok {
+		log = l.Interface
+	}
+	return db.Session(&gorm.Session{Context: context.WithValue(ctx, debugKey{}, &debugScope{debug: debug, relation: relation}), Logger: debugLogger{log}})
+}
+
+// withDebugRelation returns the db recording the queries of the nested relation, db itself if it isn't recording
+func withDebugRelation(db *gorm.DB, relName string) *gorm.DB {
+	if scope := debugScopeOf(db); scope != nil {
+		relation := relName
+		if len(scope.relation) > 0 {
+			relation = scope.relation + "." + relName
+		}
+		return withDebug(db, scope.debug, relation)
+	}
+	return db
+}
+
+func debugScopeOf(db *gorm.DB) *debugScope {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	scope, _ := db.Statement.Context.Value(debugKey{}).(*debugScope)
+	return scope
+}
+
+// recordQuery adds the last query of tx to the debug informations, if they are collected
+func recordQuery(tx *gorm.DB, start time.Time, rows int64) {
+	scope := debugScopeOf(tx)
+	if scope == nil {
+		return
+	}
+	scope.debug.mu.Lock()
+	defer scope.debug.mu.Unlock()
+	scope.debug.Queries = append(scope.debug.Queries, DebugQuery{
+		Relation:   scope.relation,
+		SQL:        scope.sql,
+		Vars:       scope.vars,
+		Rows:       rows,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
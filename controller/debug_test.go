@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryDebug(t *testing.T) {
+	db := newTestDB(t)
+	c, w := newTestContext(db, "/")
+	args := QueryMapArgs{Sel: "ID,>Orders.ID", Model: &testCustomer{}}
+	if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true, Debug: &QueryDebug{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		relation string
+		table    string
+		rows     int64
+	}{{"", "CUSTOMERS", 3}, {"Orders", "ORDERS", 3}}
+	queries := args.Debug.Recorded()
+	if len(queries) != len(want) {
+		t.Fatalf("got %d queries, want %d: %v", len(queries), len(want), queries)
+	}
+	for i, w := range want {
+		q := queries[i]
+		if q.Relation != w.relation || !strings.Contains(q.SQL, w.table) || q.Rows != w.rows {
+			t.Errorf("query %d: got %s %q (%d rows), want relation %q on %s (%d rows)", i, q.Relation, q.SQL, q.Rows, w.relation, w.table, w.rows)
+		}
+	}
+
+	// The queries are in the body of the response, wrapped even without wrap=1
+	WriteQueryMapResult(c, &args)
+	response := struct {
+		Data  []map[string]any
+		Debug []DebugQuery
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 3 || len(response.Debug) != len(want) {
+		t.Errorf("got %s", w.Body.String())
+	}
+	if w.Header().Get("X-Debug-Queries") != "" {
+		t.Error("the queries must not be in the headers")
+	}
+}
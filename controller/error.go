@@ -11,9 +11,11 @@ import (
 var EnableRecover bool
 
 type Response struct {
-	Data  interface{}
-	Next  string
-	Count int64
+	Data   interface{}
+	Next   string
+	Cursor string `json:",omitempty" xml:",omitempty"`
+	Count  int64
+	Debug  []DebugQuery `json:",omitempty" xml:"-"`
 }
 
 func AbortIfError(c *gin.Context, err error) bool {
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+ResultETag returns the ETag of the result. When the model implements model.VersionModel, the version field
+is selected and the rows contain only columns of the model, the ETag is computed from the versions of the rows and
+the query, otherwise from the serialized result. The ETag of a single record is its version, so that it can be sent
+back in the If-Match header of the updates (see RequestVersion): it's weak (W/"<version>"), since the version is the
+same for every representation of the record (Accept, time zone, sel and rel).
+*/
+func ResultETag(c *gin.Context, args *QueryMapArgs) string {
+	versions, versioned := resultVersions(args)
+	if versioned && len(args.Primaries) != 0 && len(versions) == 1 {
+		if version, ok := FormatVersion(versions[0]); ok {
+			return `W/"` + version + `"`
+		}
+	}
+	h := sha256.New()
+	io.WriteString(h, c.GetHeader("Accept")+"\n"+c.Query("wrap")+"\n"+requestLocationOrUTC(c).String()+"\n")
+	encoder := json.NewEncoder(h)
+	if versioned {
+		io.WriteString(h, c.Request.URL.RawQuery+"\n")
+		encoder.Encode(Response{Data: versions, Cursor: args.NextCursor, Count: args.Count})
+	} else {
+		encoder.Encode(Response{Data: args.Result, Cursor: args.NextCursor, Count: args.Count})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// resultVersions returns the versions of the rows, false when they don't identify the result (see versionedResult)
+func resultVersions(args *QueryMapArgs) ([]any, bool) {
+	mdl, ok := args.Model.(model.VersionModel)
+	if !ok || !versionedResult(&args.Info) {
+		return nil, false
+	}
+	field := mdl.VersionField()
+	versions := make([]any, len(args.Result))
+	for i, row := range args.Result {
+		if versions[i], ok = row[field]; !ok {
+			return nil, false
+		}
+	}
+	return versions, true
+}
+
+// versionedResult reports whether the rows change only with their version: the nested relations, the fields of the
+// joined relations, the query and computed fields and the aggregates can change while the version stays the same
+func versionedResult(info *ModelInfo) bool {
+	if len(info.Nested) > 0 || len(info.Relations) > 0 || len(info.Computed) > 0 || info.Aggregate {
+		return false
+	}
+	for _, f := range info.Fields {
+		if _, ok := f.Tag.Lookup("query"); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ResultLastModified returns the last modified time of a single record, if the model implements model.LastModifiedModel
+func ResultLastModified(args *QueryMapArgs) (time.Time, bool) {
+	mdl, ok := args.Model.(model.LastModifiedModel)
+	if !ok || len(args.Primaries) == 0 || len(args.Result) != 1 {
+		return time.Time{}, false
+	}
+	val := reflect.ValueOf(args.Result[0][mdl.LastModifiedField()])
+	for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return time.Time{}, false
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() || !val.Type().ConvertibleTo(timeType) {
+		return time.Time{}, false
+	}
+	t := val.Convert(timeType).Interface().(time.Time)
+	return t, !t.IsZero()
+}
+
+/*
+WriteConditionalHeaders sets the ETag, Last-Modified and Vary headers of the result and reports whether the copy of
+the client is still valid: If-None-Match is checked first, If-Modified-Since only when it's missing (RFC 7232).
+*/
+func WriteConditionalHeaders(c *gin.Context, args *QueryMapArgs) bool {
+	etag := ResultETag(c, args)
+	c.Header("ETag", etag)
+	c.Header("Vary", "Accept, Timezone")
+	lastModified, hasLastModified := ResultLastModified(args)
+	if hasLastModified {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		// Weak comparison
+		etag = strings.TrimPrefix(etag, "W/")
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" && hasLastModified {
+		if since, err := http.ParseTime(ifModifiedSince); err == nil {
+			return !lastModified.Truncate(time.Second).After(since)
+		}
+	}
+	return false
+}
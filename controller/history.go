@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// WriteHistory replies with the audit trail of the record, the most recent writes first. The record must be visible
+// through QueryMap, so its default conditions apply and the soft deleted ones require includeDeleted=1.
+// It replies 501 Not Implemented if the audit trail isn't enabled (see callbacks.RegisterAudit).
+func WriteHistory(c *gin.Context, mdl any) {
+	if c.IsAborted() {
+		return
+	}
+	if !app.Flags.Has(app.AuditFlag) {
+		message.AuditNotEnabled(c).Abort(c)
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+
+	includeDeleted, msg := CheckIncludeDeleted(c, mdl)
+	if msg != nil {
+		msg.Abort(c)
+		return
+	}
+	val := reflect.Indirect(reflect.ValueOf(mdl))
+	primaries := map[string]any{}
+	names := make([]string, len(modelSchema.PrimaryFields))
+	for i, field := range modelSchema.PrimaryFields {
+		primaries[field.DBName], _ = field.ValueOf(c, val)
+		names[i] = field.Name
+	}
+	args := QueryMapArgs{Sel: strings.Join(names, ","), Primaries: primaries, Model: reflect.New(modelSchema.ModelType).Interface()}
+	if AbortIfError(c, QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true, IncludeDeleted: includeDeleted})) {
+		return
+	}
+
+	pagStart, pagEnd := c.Query("pagStart"), c.Query("pagEnd")
+	tx := db.Model(&app.AuditEntry{}).Where(map[string]any{"CONTEXT": modelSchema.Table, "PRIMARY_KEYS": app.AuditKey(c, modelSchema, reflect.ValueOf(mdl))})
+	var count int64
+	if AbortIfError(c, tx.Session(&gorm.Session{}).Count(&count).Error) {
+		return
+	}
+	entries := []app.AuditEntry{}
+	if AbortIfError(c, tx.Order("ID_AUDIT DESC").Scopes(Paginate(pagStart, pagEnd)).Find(&entries).Error) {
+		return
+	}
+	WriteDataWithCount(c, pagStart, pagEnd, &entries, count)
+}
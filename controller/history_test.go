@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Datosystem/go_api_core/app"
+	"gorm.io/gorm"
+)
+
+// testActiveCustomer hides the customer 3 through its default conditions
+type testActiveCustomer struct {
+	ID   int `gorm:"primaryKey"`
+	NAME string
+}
+
+func (testActiveCustomer) TableName() string {
+	return "CUSTOMERS"
+}
+
+func (testActiveCustomer) DefaultConditions(db *gorm.DB, table string) (string, []any) {
+	return table + ".ID <> ?", []any{3}
+}
+
+func TestWriteHistory(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&app.AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	entries := []app.AuditEntry{
+		{CONTEXT: "CUSTOMERS", PRIMARY_KEYS: "[1]", OPERATION: app.AuditCreate, CREATED_AT: time.Now()},
+		{CONTEXT: "CUSTOMERS", PRIMARY_KEYS: "[3]", OPERATION: app.AuditCreate, CREATED_AT: time.Now()},
+	}
+	if err := db.Create(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The history isn't available until the audit is enabled
+	c, w := newTestContext(db, "/")
+	WriteHistory(c, &testActiveCustomer{ID: 1})
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNotImplemented)
+	}
+
+	app.Flags.Add(app.AuditFlag)
+	t.Cleanup(func() { app.Flags.Remove(app.AuditFlag) })
+	tests := []struct {
+		id     int
+		status int
+	}{{1, http.StatusOK}, {3, http.StatusNotFound}, {4, http.StatusNotFound}}
+	for _, tt := range tests {
+		c, w := newTestContext(db, "/")
+		WriteHistory(c, &testActiveCustomer{ID: tt.id})
+		if w.Code != tt.status {
+			t.Errorf("customer %d: got status %d, want %d", tt.id, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type ImportRowResult struct {
+	Row     int    `json:"row"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun         bool              `json:"dryRun"`
+	Created        int               `json:"created"`
+	Updated        int               `json:"updated"`
+	Errors         int               `json:"errors"`
+	IgnoredColumns []string          `json:"ignoredColumns"`
+	Rows           []ImportRowResult `json:"rows"`
+}
+
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportError   = "error"
+)
+
+var importDateFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "02/01/2006 15:04:05", "02/01/2006 15:04", "02/01/2006"}
+
+/*
+Import creates or updates the records contained in a JSON array or in a CSV file with a heading row.
+CSV columns are matched to the fields by name, label or database name, the "map" query param allows to specify
+the mapping manually (eg. {"Column": "FIELD"}) and "sep" the separator (detected from the heading otherwise).
+Records are updated when a record with the same updateKey fields (or primary keys if none is defined) exists, the
+updates of versioned models (see model.VersionModel) require the version of the record in the $version field or column.
+The rows of soft deleted records fail, the records must be restored before being imported again.
+The import is executed in a single transaction that is rolled back if any row fails or with dryRun=1.
+Rows are numbered from 1.
+*/
+func (r Controller) Import(c *gin.Context) {
+	HandleImport(c, c.MustGet("db").(*gorm.DB), r.GetModel())
+}
+
+func HandleImport(c *gin.Context, db *gorm.DB, mdl any) {
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		message.InvalidJSON(c).Abort(c)
+		return
+	}
+
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+
+	result := ImportResult{DryRun: c.Query("dryRun") == "1", IgnoredColumns: []string{}, Rows: []ImportRowResult{}}
+	var rows []map[string]any
+	contentType := c.ContentType()
+	switch contentType {
+	case "application/csv", "text/csv":
+		var msg message.Message
+		rows, result.IgnoredColumns, msg = ParseImportCsv(c, data, modelSchema)
+		if msg != nil {
+			msg.Abort(c)
+			return
+		}
+	case "application/json", "":
+		if data[0] != '[' {
+			data = append(append([]byte{'['}, data...), ']')
+		}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			message.InvalidJSON(c).Text(err.Error()).Abort(c)
+			return
+		}
+	default:
+		message.UnsupportedMediaType(c, contentType).Abort(c)
+		return
+	}
+
+	keyFields := ImportKeyFields(modelSchema)
+	modelType := modelSchema.ModelType
+	newModel := func() any { return reflect.New(modelType).Interface() }
+
+	var patchChecked bool
+	var abortMsg message.Message
+	db.Transaction(func(tx *gorm.DB) error {
+		checked := map[string]struct{}{}
+		for i, row := range rows {
+			rowResult := ImportRowResult{Row: i + 1}
+			_, action, err := upsertRow(c, tx, modelSchema, keyFields, newModel, row, checked, func() message.Message {
+				if !patchChecked {
+					patchChecked = true
+					return model.PermissionsPatch(newModel())(c)
+				}
+				return nil
+			})
+			if abort, ok := err.(importAbort); ok {
+				abortMsg = abort.Message
+				return err
+			}
+			if errors.Is(err, errVersionConflict) {
+				err = message.VersionConflict(c)
+			}
+			if err != nil {
+				rowResult.Action = ImportError
+				rowResult.Message = message.RowError(c, i+1, " "+err.Error()).Error()
+				result.Errors++
+			} else {
+				rowResult.Action = action
+				if action == ImportCreated {
+					result.Created++
+				} else {
+					result.Updated++
+				}
+			}
+			result.Rows = append(result.Rows, rowResult)
+		}
+		if result.Errors > 0 || result.DryRun {
+			return errors.New("rollback")
+		}
+		return nil
+	})
+
+	if abortMsg != nil {
+		abortMsg.Abort(c)
+		return
+	}
+	if result.Errors > 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+	} else {
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// importAbort stops the whole import, used for permission errors
+type importAbort struct {
+	message.Message
+}
+
+// upsertRow creates or updates a single record returning it with the performed action
+func upsertRow(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, keyFields []*schema.Field, newModel func() any, row map[string]any, checked map[string]struct{}, checkPatch func() message.Message) (any, string, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var existing any
+	if len(keyFields) > 0 {
+		conds := map[string]any{}
+		for _, f := range keyFields {
+			val, ok := row[f.Name]
+			if !ok || val == nil {
+				conds = nil
+				break
+			}
+			conds[f.DBName] = val
+		}
+		if conds != nil {
+			existing = newModel()
+			// The record is locked until the end of the transaction, so it can't be written or inserted concurrently
+			ltx := dialect.For(tx).LockRows(tx.Session(&gorm.Session{NewDB: true}).Model(existing), modelSchema.Table)
+			if condMdl, ok := existing.(model.ConditionsModel); ok {
+				query, args := condMdl.DefaultConditions(tx, modelSchema.Table)
+				if query != "" {
+					ltx = ltx.Where("("+query+")", args...)
+				}
+			}
+			res := ltx.Where(conds).Limit(1).Find(existing)
+			if res.Error != nil {
+				return nil, "", ExposeSQLErr(c, res.Error)
+			}
+			if res.RowsAffected == 0 {
+				existing = nil
+			} else if isDeleted(c, existing, modelSchema) {
+				// The deleted records are neither updated nor inserted again, they must be restored first
+				return nil, "", message.RecordDeleted(c)
+			}
+		}
+	}
+
+	if existing != nil {
+		if msg := checkPatch(); msg != nil {
+			return nil, "", importAbort{msg}
+		}
+		if err := json.Unmarshal(data, existing); err != nil {
+			return nil, "", unprocessable(c, err)
+		}
+		if err := ValidateStruct(c, existing); err != nil {
+			return nil, "", unprocessable(c, err)
+		}
+		if msg := CheckModelPermissions(c, reflect.ValueOf(existing), modelSchema, checked, false); msg != nil {
+			return nil, "", importAbort{msg}
+		}
+		versionField := VersionField(existing, modelSchema)
+		var version any
+		if versionField != nil {
+			if row[versionBodyField] == nil {
+				return nil, "", message.VersionRequired(c, versionField.Name)
+			}
+			var msg message.Message
+			if version, msg = ParseVersion(c, versionField, row[versionBodyField]); msg != nil {
+				return nil, "", msg
+			}
+		}
+		val := reflect.ValueOf(existing).Elem()
+		values := map[string]any{}
+		for key := range row {
+			if f := modelSchema.LookUpField(key); f != nil && f.Updatable && !f.PrimaryKey && f != versionField {
+				values[f.Name], _ = f.ValueOf(c, val)
+			}
+		}
+		if len(values) > 0 {
+			if err := updateVersioned(tx, existing, values, versionField, version); errors.Is(err, errVersionConflict) {
+				return existing, "", err
+			} else if err != nil {
+				return nil, "", ExposeSQLErr(c, err)
+			}
+		}
+		return existing, ImportUpdated, nil
+	}
+
+	mdl := newModel()
+	if err := json.Unmarshal(data, mdl); err != nil {
+		return nil, "", unprocessable(c, err)
+	}
+	if err := ValidateStruct(c, mdl); err != nil {
+		return nil, "", unprocessable(c, err)
+	}
+	if msg := CheckModelPermissions(c, reflect.ValueOf(mdl), modelSchema, checked, false); msg != nil {
+		return nil, "", importAbort{msg}
+	}
+	if res := tx.Create(mdl); res.Error != nil {
+		return nil, "", ExposeSQLErr(c, res.Error)
+	}
+	return mdl, ImportCreated, nil
+}
+
+// unprocessable returns the invalid data error as a message, unless it's one already
+func unprocessable(c *gin.Context, err error) error {
+	if _, ok := err.(message.Message); ok {
+		return err
+	}
+	return message.Unprocessable(c).Text(err.Error())
+}
+
+// ImportKeyFields returns the fields tagged with import:"updateKey", or the primary keys if there are none
+func ImportKeyFields(modelSchema *schema.Schema) []*schema.Field {
+	fields := []*schema.Field{}
+	for _, f := range modelSchema.Fields {
+		if strings.Contains(f.Tag.Get("import"), "updateKey") && f.DBName != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		fields = append(fields, modelSchema.PrimaryFields...)
+	}
+	return fields
+}
+
+// ParseImportCsv converts the CSV rows to maps of typed values keyed by field name, returning the ignored columns
+func ParseImportCsv(c *gin.Context, data []byte, modelSchema *schema.Schema) ([]map[string]any, []string, message.Message) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	sep := c.Query("sep")
+	if sep == "" {
+		heading, _, _ := bytes.Cut(data, []byte("\n"))
+		if bytes.Count(heading, []byte(";")) > bytes.Count(heading, []byte(",")) {
+			sep = ";"
+		}
+	}
+	if sep != "" {
+		reader.Comma = []rune(sep)[0]
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, message.InvalidCSV(c).Text(err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil, message.Unprocessable(c)
+	}
+
+	mapping := map[string]string{}
+	if m := c.Query("map"); m != "" {
+		if json.Unmarshal([]byte(m), &mapping) != nil {
+			return nil, nil, message.InvalidParamsJSON(c)
+		}
+	}
+	byName := map[string]*schema.Field{}
+	for _, f := range modelSchema.Fields {
+		if f.DBName == "" || !(f.Creatable || f.Updatable) {
+			continue
+		}
+		for _, name := range []string{f.DBName, FieldLabel(f.StructField), f.Name} {
+			byName[strings.ToLower(strings.TrimSpace(name))] = f
+		}
+	}
+
+	ignored := []string{}
+	columns := make([]*schema.Field, len(records[0]))
+	versionColumn := -1
+	for i, col := range records[0] {
+		name := strings.TrimSpace(col)
+		if name == versionBodyField {
+			versionColumn = i
+			continue
+		}
+		if mapped, ok := mapping[name]; ok {
+			columns[i] = modelSchema.LookUpField(mapped)
+		} else {
+			columns[i] = byName[strings.ToLower(name)]
+		}
+		if columns[i] == nil {
+			ignored = append(ignored, name)
+		}
+	}
+
+	rows := []map[string]any{}
+	for i, record := range records[1:] {
+		row := map[string]any{}
+		for j, val := range record {
+			if j >= len(columns) || columns[j] == nil {
+				continue
+			}
+			v, err := csvToValue(columns[j], val)
+			if err != nil {
+				return nil, nil, message.RowError(c, i+1, " "+message.InvalidParamType(c, columns[j].Name, columns[j].IndirectFieldType.String()).Error())
+			}
+			row[columns[j].Name] = v
+		}
+		if versionColumn != -1 && versionColumn < len(record) && strings.TrimSpace(record[versionColumn]) != "" {
+			row[versionBodyField] = strings.TrimSpace(record[versionColumn])
+		}
+		rows = append(rows, row)
+	}
+	return rows, ignored, nil
+}
+
+func csvToValue(field *schema.Field, val string) (any, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil, nil
+	}
+	typ := field.IndirectFieldType
+	if typ.ConvertibleTo(timeType) {
+		for _, format := range importDateFormats {
+			if t, err := time.ParseInLocation(format, val, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return nil, errors.New("invalid date")
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(val, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(val, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		if strings.Contains(val, ",") {
+			// Decimal comma, the dots are thousands separators
+			val = strings.ReplaceAll(strings.ReplaceAll(val, ".", ""), ",", ".")
+		}
+		return strconv.ParseFloat(val, 64)
+	case reflect.Bool:
+		switch strings.ToLower(val) {
+		case "si", "sì", "s", "yes", "y", "x":
+			return true, nil
+		case "no", "n":
+			return false, nil
+		}
+		return strconv.ParseBool(val)
+	}
+	return val, nil
+}
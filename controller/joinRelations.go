@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/Datosystem/go_api_core/model"
 	"github.com/Datosystem/go_api_core/params"
@@ -22,16 +23,50 @@ type DynamicModel struct {
 }
 
 type ModelInfo struct {
-	Select     []string
-	SelectArgs []any
-	Fields     []reflect.StructField
-	Schema     *schema.Schema
-	Table      string
-	Order      string
-	Relations  map[string]*params.Conditions
-	Nested     map[string]NestedModel
-	Aggregate  bool
-	Distinct   bool
+	Select      []string
+	SelectArgs  []any
+	Fields      []reflect.StructField
+	Schema      *schema.Schema
+	Table       string
+	Order       string
+	OrderFields []OrderField
+	Relations   map[string]*params.Conditions
+	Nested      map[string]NestedModel
+	Aggregate   bool
+	Distinct    bool
+	// Expressions of the GROUP BY, used when Aggregate is set
+	GroupBy []string
+	// Expression of the key of the parent rows, set on the models of the nested relations
+	ParentKey string
+	// Rows loaded for each parent row by a nested slice (eg. >Lines[0:5]), all of them when Limit is 0
+	Offset int
+	Limit  int
+	// Count adds the number of rows of the nested slice to the parent rows, named CountName (eg. LinesCount)
+	Count     bool
+	CountName string
+	// Fields computed on the rows after they are read, see ComputeFields
+	Computed []ComputedField
+	// Dependencies of the computed fields selected only to compute them, removed from the rows
+	Hidden map[string]struct{}
+}
+
+/*
+ComputedField is a field tagged with compute, computed by the method of the model named as the tag value
+(Compute<FIELD> if empty) with signature func(*gin.Context, map[string]any) any. The row contains the selected
+values as pointers, the fields listed in the depends tag (eg. depends:"QTY,PRICE") are selected when missing.
+*/
+type ComputedField struct {
+	Name    string
+	Compute func(*gin.Context, map[string]any) any
+}
+
+// OrderField describes a single column of the ORDER BY clause. Field is nil
+// when the order is not on a plain column (aliases, query fields, ! casts).
+type OrderField struct {
+	Name  string
+	Table string
+	Field *schema.Field
+	Desc  bool
 }
 
 type NestedModel struct {
@@ -47,6 +82,7 @@ func (n NestedModel) NextNested() map[string]NestedModel {
 var fkAlias = "___FK___"
 
 func JoinRelations(c *gin.Context, d *gorm.DB, config QueryMapConfig, modelInfo *ModelInfo, relations map[string]*params.Conditions) {
+	q := dialect.For(d)
 	joins := ""
 	joinsArgs := []interface{}{}
 	joinedTables := map[string]*schema.Schema{}
@@ -79,9 +115,9 @@ func JoinRelations(c *gin.Context, d *gorm.DB, config QueryMapConfig, modelInfo
 							joins += " AND "
 						}
 						if i > 0 {
-							joins += ` ` + strings.Join(pieces[:i], "__") + `.` + ref.PrimaryKey.DBName + ` = ` + alias + `.` + ref.ForeignKey.DBName
+							joins += ` ` + strings.Join(pieces[:i], "__") + `.` + q.Quote(ref.PrimaryKey.DBName) + ` = ` + alias + `.` + q.Quote(ref.ForeignKey.DBName)
 						} else {
-							joins += ` ` + modelInfo.Table + `.` + ref.PrimaryKey.DBName + ` = ` + alias + `.` + ref.ForeignKey.DBName
+							joins += ` ` + modelInfo.Table + `.` + q.Quote(ref.PrimaryKey.DBName) + ` = ` + alias + `.` + q.Quote(ref.ForeignKey.DBName)
 						}
 					}
 					if !config.SkipDefaults {
@@ -97,6 +133,12 @@ func JoinRelations(c *gin.Context, d *gorm.DB, config QueryMapConfig, modelInfo
 							joins += model.DefaultJoins(d, alias)
 						}
 					}
+					if !config.IncludeDeleted {
+						if query, args := NotDeletedCondition(q, reflect.New(rel.FieldSchema.ModelType).Interface(), rel.FieldSchema, alias); query != "" {
+							joins += " AND " + query
+							joinsArgs = append(joinsArgs, args...)
+						}
+					}
 				}
 			} else {
 				d.AddError(message.InvalidRelations(c, strings.Join(pieces[:i+1], ".")))
@@ -132,7 +174,7 @@ func ModelToTableNames(stmt *string, modelSchema *schema.Schema) []string {
 	return relations
 }
 
-func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, computedFields map[string]string, modelInfo *ModelInfo, args *QueryMapArgs) message.Message {
+func GetModelInfo(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, selects string, computedFields map[string]string, modelInfo *ModelInfo, args *QueryMapArgs) message.Message {
 	modelInfo.Table = strings.TrimSpace(modelInfo.Schema.Table)
 	if strings.HasSuffix(modelInfo.Table, ")") {
 		modelInfo.Table = queryTableName
@@ -140,6 +182,7 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 		modelInfo.Table = modelInfo.Table[index+5:]
 	}
 
+	groupNames := []string{}
 	if len(selects) > 0 {
 		if strings.HasPrefix(selects, "DISTINCT ") {
 			selects = selects[9:]
@@ -147,8 +190,10 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 		}
 
 		fields := strings.Split(selects, ",")
-		for j, field := range fields {
-			field = strings.TrimSpace(field)
+		// The dependencies of the computed fields are appended to the requested fields
+		requested := len(fields)
+		for j := 0; j < len(fields); j++ {
+			field := strings.TrimSpace(fields[j])
 			if len(field) == 0 {
 				continue
 			}
@@ -160,15 +205,9 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 				field = field[:index]
 			}
 
-			sum := false
-			count := false
-			if strings.HasPrefix(field, "SUM(") && strings.HasSuffix(field, ")") {
-				field = field[4 : len(field)-1]
-				sum = true
-			}
-			if strings.HasPrefix(field, "COUNT(") && strings.HasSuffix(field, ")") {
-				field = field[6 : len(field)-1]
-				count = true
+			aggregate, inner, isAggregate := params.ParseAggregate(field)
+			if isAggregate {
+				field = inner
 			}
 
 			if pos := strings.Index(field, "<."); pos != -1 {
@@ -187,14 +226,22 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 			key := ""
 			for i := 0; i < len(pieces)-1; i++ {
 				var nested bool
+				var window *nestedWindow
 				if strings.HasPrefix(pieces[i], ">") {
-					pieces[i] = pieces[i][1:]
+					var msg message.Message
+					pieces[i], window, msg = parseNestedWindow(c, pieces[i][1:])
+					if msg != nil {
+						return msg
+					}
 					nested = true
 				}
 				if key != "" {
 					key += "."
 				}
 				key += pieces[i]
+				if !params.AllowedPath(relSchema, pieces[i], model.SelectableFields) {
+					return message.FieldNotSelectable(c, strings.Join(pieces[:i+1], "."))
+				}
 				if rel, ok := relSchema.Relationships.Relations[pieces[i]]; ok {
 					relSchema = rel.FieldSchema
 					if nested {
@@ -211,27 +258,43 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 							if ordMdl, ok := mdl.(model.OrderedModel); ok {
 								n.ModelInfo.Order = ordMdl.DefaultOrder(c.MustGet("db").(*gorm.DB), n.ModelInfo.Table)
 							}
-							l := len(rel.References)
 							var fk string
-							for j, ref := range rel.References {
-								if j > 0 {
-									fk += ",'___',"
-								}
-								if l > 1 {
-									fk += "CAST(" + n.ModelInfo.Table + "." + ref.ForeignKey.DBName + " AS NVARCHAR(MAX))"
-								} else {
-									fk += n.ModelInfo.Table + "." + ref.ForeignKey.DBName
-								}
-							}
 							if len(rel.References) > 1 {
-								fk = "CONCAT(" + fk + ")"
+								parts := []string{}
+								for j, ref := range rel.References {
+									if j > 0 {
+										parts = append(parts, "'___'")
+									}
+									parts = append(parts, "COALESCE("+d.CastText(n.ModelInfo.Table+"."+d.Quote(ref.ForeignKey.DBName))+", '')")
+								}
+								fk = d.Concat(parts...)
+							} else {
+								fk = n.ModelInfo.Table + "." + d.Quote(rel.References[0].ForeignKey.DBName)
 							}
 							n.ModelInfo.Select = []string{fk + " AS " + fkAlias}
+							n.ModelInfo.GroupBy = []string{fk}
+							n.ModelInfo.ParentKey = fk
 							if rel.Field.FieldType.Kind() == reflect.Slice {
 								n.Slice = true
 							}
 							info.Nested[key] = n
 						}
+						if window != nil {
+							if !info.Nested[key].Slice {
+								return message.InvalidRelation(c, strings.Join(pieces[:i+1], "."))
+							}
+							n := info.Nested[key].ModelInfo
+							if window.Limit > 0 || window.Offset > 0 {
+								n.Offset, n.Limit = window.Offset, window.Limit
+							}
+							if window.Count {
+								n.Count = true
+								n.CountName = window.CountName
+								if n.CountName == "" {
+									n.CountName = pieces[i] + countSuffix
+								}
+							}
+						}
 						startIndex = i + 1
 						info = info.Nested[key].ModelInfo
 						key = ""
@@ -252,7 +315,7 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 				for _, fld := range relSchema.Fields {
 					_, okQ := fld.Tag.Lookup("query")
 					_, okC := fld.Tag.Lookup("compute")
-					if !okQ && !okC {
+					if !okQ && !okC && params.AllowedPath(relSchema, fld.Name, model.SelectableFields) {
 						structFields = append(structFields, fld)
 					}
 				}
@@ -261,12 +324,29 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 				if fld == nil {
 					return message.InvalidField(c, field)
 				}
-				if (sum || count) && fieldAlias == "" {
+				if !params.AllowedPath(relSchema, fld.Name, model.SelectableFields) {
+					return message.FieldNotSelectable(c, field)
+				}
+				if isAggregate && fieldAlias == "" {
 					fieldAlias = fieldName
 				}
 				structFields = []*schema.Field{fld}
 			}
 
+			if j >= requested {
+				if info.Aggregate {
+					return message.UngroupedField(c, field)
+				}
+				if hasField(info, structFields[0].Name) {
+					continue
+				}
+				if info.Hidden == nil {
+					info.Hidden = map[string]struct{}{}
+				}
+				info.Hidden[structFields[0].Name] = struct{}{}
+			}
+			pathPrefix := field[:strings.LastIndex(field, ".")+1]
+
 			if len(pieces)-startIndex > 1 {
 				info.Relations[strings.Join(pieces[startIndex:len(pieces)-1], ".")] = &params.Conditions{}
 			}
@@ -282,7 +362,29 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 						funcName = "Compute" + field.Name
 					}
 					computedFields[strings.Join(pieces, ".")] = funcName
-					// Here, instead of funcName, I would include the entire function
+					fn := reflect.New(relSchema.ModelType).MethodByName(funcName)
+					if !fn.IsValid() {
+						return message.InvalidField(c, field.Name)
+					}
+					compute, ok := fn.Interface().(func(*gin.Context, map[string]any) any)
+					if !ok {
+						return message.InvalidField(c, field.Name)
+					}
+					name := field.Name
+					if len(fieldAlias) > 0 {
+						name = strings.ReplaceAll(fieldAlias, "*", field.Name)
+					}
+					if j >= requested {
+						// Computed dependencies are computed first
+						info.Computed = append([]ComputedField{{Name: name, Compute: compute}}, info.Computed...)
+					} else {
+						info.Computed = append(info.Computed, ComputedField{Name: name, Compute: compute})
+					}
+					for _, dep := range strings.Split(field.Tag.Get("depends"), ",") {
+						if dep = strings.TrimSpace(dep); len(dep) > 0 {
+							fields = append(fields, pathPrefix+dep)
+						}
+					}
 				} else if funcName, ok := field.StructField.Tag.Lookup("query"); ok {
 					field.StructField.Tag = reflect.StructTag(strings.TrimPrefix(string(field.StructField.Tag), `gorm:"-"`))
 					if len(funcName) == 0 {
@@ -306,25 +408,32 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 						return message.InvalidField(c, field.Name)
 					}
 				} else if len(field.DBName) != 0 {
-					sel = table + ".[" + field.DBName + "]"
+					sel = table + "." + d.Quote(field.DBName)
 				}
 				if len(sel) > 0 {
-					if sum {
-						sel = "SUM(" + sel + ")"
-						info.Aggregate = true
-					}
-					if count {
-						sel = "COUNT(" + sel + ")"
+					structField := field.StructField
+					if isAggregate {
+						sel = params.AggregateToSql(aggregate, sel)
 						info.Aggregate = true
+						switch aggregate {
+						case "COUNT", params.CountDistinct:
+							structField.Type = reflect.TypeOf(int64(0))
+						case "AVG":
+							structField.Type = reflect.TypeOf(float64(0))
+						}
+					} else {
+						info.GroupBy = append(info.GroupBy, sel)
+						if info == modelInfo {
+							groupNames = append(groupNames, pathPrefix+field.Name)
+						}
 					}
-					structField := field.StructField
 					if len(fieldAlias) > 0 {
 						r := regexp.MustCompile(`^[\w*]+$`)
 						if !r.MatchString(fieldAlias) {
 							return message.InvalidFieldAlias(c, fieldAlias, fieldName)
 						}
 						structField.Name = strings.ReplaceAll(fieldAlias, "*", field.Name)
-						sel += " AS [" + structField.Name + "]"
+						sel += " AS " + d.Quote(structField.Name)
 					}
 					info.Fields = append(info.Fields, structField)
 					info.Select = append(info.Select, sel)
@@ -333,28 +442,122 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, co
 		}
 	} else {
 		for _, field := range modelSchema.Fields {
-			if field.Readable && len(field.DBName) != 0 {
+			if field.Readable && len(field.DBName) != 0 && params.AllowedPath(modelSchema, field.Name, model.SelectableFields) {
 				modelInfo.Fields = append(modelInfo.Fields, field.StructField)
-				modelInfo.Select = append(modelInfo.Select, modelInfo.Table+"."+field.DBName)
+				modelInfo.Select = append(modelInfo.Select, modelInfo.Table+"."+d.Quote(field.DBName))
+				modelInfo.GroupBy = append(modelInfo.GroupBy, modelInfo.Table+"."+d.Quote(field.DBName))
+				groupNames = append(groupNames, field.Name)
 			}
 		}
 	}
+	if msg := checkCountNames(c, modelInfo); msg != nil {
+		return msg
+	}
+	if len(args.Group) > 0 {
+		if msg := ParseGroup(c, d, args.Group, modelInfo, groupNames); msg != nil {
+			return msg
+		}
+	}
 	if len(args.Ord) > 0 {
-		msg := ParseOrder(c, args.Ord, modelInfo)
+		msg := ParseOrder(c, d, args.Ord, modelInfo)
 		if msg != nil {
 			return msg
 		}
+		if modelInfo.Aggregate {
+			// The group by is appended to the requested order, so that the pages of grouped rows are deterministic
+			ordered := map[string]struct{}{}
+			for _, o := range modelInfo.OrderFields {
+				if o.Field != nil {
+					ordered[o.Table+"."+d.Quote(o.Field.DBName)] = struct{}{}
+				}
+			}
+			for _, g := range modelInfo.GroupBy {
+				if _, ok := ordered[g]; !ok {
+					if len(modelInfo.Order) > 0 {
+						modelInfo.Order += ","
+					}
+					modelInfo.Order += g
+				}
+			}
+		}
+	} else if modelInfo.Aggregate {
+		// The default order of the model isn't valid on grouped rows
+		modelInfo.Order = strings.Join(modelInfo.GroupBy, ",")
 	} else if ordModel, ok := reflect.New(modelSchema.ModelType).Interface().(model.OrderedModel); ok {
 		modelInfo.Order = ordModel.DefaultOrder(c.MustGet("db").(*gorm.DB), modelInfo.Table)
 	} else if modelSchema.PrioritizedPrimaryField != nil {
-		modelInfo.Order = modelInfo.Table + "." + modelSchema.PrioritizedPrimaryField.DBName
+		modelInfo.Order = modelInfo.Table + "." + d.Quote(modelSchema.PrioritizedPrimaryField.DBName)
 	}
 	return nil
 }
 
-func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
+// ParseGroup replaces the implicit GROUP BY, made of the selected fields that aren't aggregated, with the supplied fields.
+// The fields of the joined relations are specified with their path (eg. rel.FIELD), every selected field that
+// isn't aggregated must be included. The selected names of the implicit group by (eg. rel.Field) are passed in groupNames.
+func ParseGroup(c *gin.Context, d dialect.Dialect, group string, info *ModelInfo, groupNames []string) message.Message {
+	groupBy := []string{}
+	names := map[string]struct{}{}
+	for _, field := range strings.Split(group, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		relSchema := info.Schema
+		pieces := strings.Split(field, ".")
+		for i := 0; i < len(pieces)-1; i++ {
+			if rel, ok := relSchema.Relationships.Relations[pieces[i]]; ok {
+				relSchema = rel.FieldSchema
+			} else {
+				return message.InvalidRelation(c, strings.Join(pieces[:i+1], "."))
+			}
+		}
+		fld := relSchema.LookUpField(pieces[len(pieces)-1])
+		if fld == nil || len(fld.DBName) == 0 {
+			return message.InvalidField(c, field)
+		}
+		table := info.Table
+		name := fld.Name
+		if len(pieces) > 1 {
+			rel := strings.Join(pieces[:len(pieces)-1], ".")
+			name = rel + "." + fld.Name
+			if _, ok := info.Relations[rel]; !ok {
+				info.Relations[rel] = &params.Conditions{}
+			}
+			table = strings.Join(pieces[:len(pieces)-1], "__")
+		}
+		groupBy = append(groupBy, table+"."+d.Quote(fld.DBName))
+		names[name] = struct{}{}
+	}
+
+	for _, name := range groupNames {
+		if _, ok := names[name]; !ok {
+			return message.UngroupedField(c, name)
+		}
+	}
+	info.GroupBy = groupBy
+	info.Aggregate = true
+	return nil
+}
+
+// hasField reports whether the model selects or computes a field with the given name
+func hasField(info *ModelInfo, name string) bool {
+	for _, f := range info.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	for _, f := range info.Computed {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseOrder(c *gin.Context, d dialect.Dialect, order string, info *ModelInfo) message.Message {
 	if len(order) > 0 {
 		local := []string{}
+		info.OrderFields = []OrderField{}
 		nested := map[string][]string{}
 		fields := strings.Split(order, ",")
 		for i, field := range fields {
@@ -362,6 +565,9 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
 			if strings.HasPrefix(field, ">") {
 				field = field[1:]
 				pieces := strings.Split(field, ".")
+				if !params.AllowedPath(info.Schema, pieces[0], model.SortableFields) {
+					return message.FieldNotSortable(c, pieces[0])
+				}
 				if _, ok := nested[pieces[0]]; !ok {
 					nested[pieces[0]] = []string{}
 				}
@@ -394,8 +600,11 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
 				fldName := strings.TrimSuffix(strings.TrimSuffix(field, " DESC"), " ASC")
 				piece := strings.TrimSuffix(strings.TrimSuffix(pieces[len(pieces)-1], " DESC"), " ASC")
 				fld := relSchema.LookUpField(piece)
+				if fld != nil && !params.AllowedPath(info.Schema, fldName, model.SortableFields) {
+					return message.FieldNotSortable(c, fldName)
+				}
 				if fld == nil {
-					search := "[" + piece + "]"
+					search := d.Quote(piece)
 					found := false
 					for _, f := range info.Select {
 						if asIndex := strings.LastIndex(f, " AS "); asIndex != -1 {
@@ -413,6 +622,7 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
 							search += " DESC"
 						}
 						local = append(local, search)
+						info.OrderFields = append(info.OrderFields, OrderField{Name: fldName})
 					} else {
 						return message.InvalidField(c, field)
 					}
@@ -421,7 +631,7 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
 				if fld != nil {
 					if info.Distinct {
 						found := false
-						selField := "[" + fld.Name + "]"
+						selField := d.Quote(fld.Name)
 						selRel := selField
 						if len(pieces) > 1 {
 							selRel = strings.Join(pieces[:len(pieces)-1], "__") + "." + selField
@@ -442,28 +652,35 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo) message.Message {
 						}
 					}
 
-					if _, ok := fld.StructField.Tag.Lookup("query"); ok {
-						field = pieces[len(pieces)-1]
-					} else {
+					orderField := OrderField{Name: fldName, Desc: strings.HasSuffix(field, " DESC")}
+					// The direction of the order
+					suffix := strings.TrimPrefix(pieces[len(pieces)-1], piece)
+					column := d.Quote(piece)
+					if _, ok := fld.StructField.Tag.Lookup("query"); !ok {
 						alias := info.Table
 						l := len(pieces)
 						if l > 1 {
 							alias = strings.Join(pieces[:l-1], "__")
 						}
-						field = alias + "." + pieces[l-1]
+						column = alias + "." + d.Quote(fld.DBName)
+						if !toBoolean {
+							orderField.Table = alias
+							orderField.Field = fld
+						}
 					}
+					info.OrderFields = append(info.OrderFields, orderField)
 
 					if toBoolean {
-						field = "CASE WHEN " + fldName + " IS NULL THEN 0 ELSE 1 END" + field[len(fldName):]
+						column = "CASE WHEN " + column + " IS NULL THEN 0 ELSE 1 END"
 					}
-					local = append(local, field)
+					local = append(local, column+suffix)
 				}
 			}
 		}
 
 		for key, nestedArray := range nested {
 			if n, ok := info.Nested[key]; ok {
-				msg := ParseOrder(c, strings.Join(nestedArray, ","), n.ModelInfo)
+				msg := ParseOrder(c, d, strings.Join(nestedArray, ","), n.ModelInfo)
 				if msg != nil {
 					return msg
 				}
@@ -532,10 +749,8 @@ func DynamicQuery(c *gin.Context, info *ModelInfo, conditions *params.Conditions
 		d = d.Select(info.Select)
 		d.Statement.Distinct = info.Distinct
 		if info.Aggregate {
-			for _, field := range info.Select {
-				if !strings.HasPrefix(field, "SUM(") && !strings.HasPrefix(field, "COUNT(") {
-					d = d.Group(field)
-				}
+			for _, field := range info.GroupBy {
+				d = d.Group(field)
 			}
 		}
 
@@ -557,10 +772,16 @@ func DynamicQuery(c *gin.Context, info *ModelInfo, conditions *params.Conditions
 		if model, ok := mdl.(model.JoinsModel); ok {
 			d.Joins(model.DefaultJoins(d, info.Table))
 		}
+		if query, args := NotDeletedCondition(dialect.For(d), mdl, info.Schema, info.Table); query != "" {
+			d.Where(query, args...)
+		}
 
 		if len(conditions.Query) > 0 {
 			d.Where(conditions.Query, conditions.Args...)
 		}
+		if conditions.Having != nil && len(conditions.Having.Query) > 0 {
+			d.Having(conditions.Having.Query, conditions.Having.Args...)
+		}
 
 		JoinRelations(c, d, QueryMapConfig{}, info, RelationsFromModelInfo(info, conditions.Nested))
 		return d
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxKeySetParams is the maximum number of parameters bound by a single key set condition,
+// SQL Server supports up to 2100 parameters per query and some of them can be used by other conditions
+var MaxKeySetParams = 2000
+
+// ChunkKeySet splits the key tuples in chunks binding at most MaxKeySetParams parameters
+func ChunkKeySet(keys [][]any) [][][]any {
+	if len(keys) == 0 {
+		return nil
+	}
+	size := MaxKeySetParams / len(keys[0])
+	if size < 1 {
+		size = 1
+	}
+	chunks := [][][]any{}
+	for len(keys) > size {
+		chunks = append(chunks, keys[:size])
+		keys = keys[size:]
+	}
+	return append(chunks, keys)
+}
+
+/*
+KeySetCondition returns the condition matching the key tuples on the columns, the values are bound as parameters.
+Tuples are grouped by their leading values (eg. "((A = ? AND B IN ?) OR (A = ? AND B IN ?))") and nil values match NULL.
+*/
+func KeySetCondition(columns []string, keys [][]any) (string, []any) {
+	conds := []string{}
+	args := []any{}
+	if len(columns) == 1 {
+		values := []any{}
+		var hasNull bool
+		for _, key := range keys {
+			if key[0] == nil {
+				hasNull = true
+			} else {
+				values = append(values, key[0])
+			}
+		}
+		if len(values) != 0 {
+			conds = append(conds, columns[0]+" IN ?")
+			args = append(args, values)
+		}
+		if hasNull {
+			conds = append(conds, columns[0]+" IS NULL")
+		}
+		if len(conds) == 1 {
+			return conds[0], args
+		}
+		return "(" + strings.Join(conds, " OR ") + ")", args
+	}
+
+	groups := map[string]int{}
+	firsts := []any{}
+	rests := [][][]any{}
+	for _, key := range keys {
+		group := fmt.Sprintf("%T:%v", key[0], key[0])
+		index, ok := groups[group]
+		if !ok {
+			index = len(firsts)
+			groups[group] = index
+			firsts = append(firsts, key[0])
+			rests = append(rests, [][]any{})
+		}
+		rests[index] = append(rests[index], key[1:])
+	}
+	for i, first := range firsts {
+		query, restArgs := KeySetCondition(columns[1:], rests[i])
+		if first == nil {
+			conds = append(conds, columns[0]+" IS NULL AND "+query)
+		} else {
+			conds = append(conds, columns[0]+" = ? AND "+query)
+			args = append(args, first)
+		}
+		args = append(args, restArgs...)
+	}
+	if len(conds) == 1 {
+		return conds[0], args
+	}
+	return "((" + strings.Join(conds, ") OR (") + "))", args
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeySetCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		keys    [][]any
+		query   string
+		args    []any
+	}{
+		{"single column", []string{"A"}, [][]any{{1}, {2}}, "A IN ?", []any{[]any{1, 2}}},
+		{"single column with NULL", []string{"A"}, [][]any{{1}, {nil}}, "(A IN ? OR A IS NULL)", []any{[]any{1}}},
+		{"only NULL", []string{"A"}, [][]any{{nil}}, "A IS NULL", []any{}},
+		{"composite", []string{"A", "B"}, [][]any{{1, 2}, {1, 3}}, "A = ? AND B IN ?", []any{1, []any{2, 3}}},
+		{
+			"composite grouped", []string{"A", "B"}, [][]any{{1, 2}, {2, 3}, {1, 4}},
+			"((A = ? AND B IN ?) OR (A = ? AND B IN ?))", []any{1, []any{2, 4}, 2, []any{3}},
+		},
+		{
+			"composite with NULL", []string{"A", "B"}, [][]any{{nil, 2}, {1, nil}},
+			"((A IS NULL AND B IN ?) OR (A = ? AND B IS NULL))", []any{[]any{2}, 1},
+		},
+		{
+			// Values of different types aren't grouped together
+			"types", []string{"A", "B"}, [][]any{{1, 2}, {"1", 3}},
+			"((A = ? AND B IN ?) OR (A = ? AND B IN ?))", []any{1, []any{2}, "1", []any{3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := KeySetCondition(tt.columns, tt.keys)
+			if query != tt.query {
+				t.Errorf("got query %s, want %s", query, tt.query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestChunkKeySet(t *testing.T) {
+	defer func(max int) { MaxKeySetParams = max }(MaxKeySetParams)
+	MaxKeySetParams = 4
+
+	keys := func(n, size int) [][]any {
+		result := make([][]any, n)
+		for i := range result {
+			result[i] = make([]any, size)
+		}
+		return result
+	}
+	tests := []struct {
+		name   string
+		keys   [][]any
+		chunks []int
+	}{
+		{"empty", nil, nil},
+		{"single chunk", keys(4, 1), []int{4}},
+		{"single column", keys(9, 1), []int{4, 4, 1}},
+		{"composite", keys(5, 2), []int{2, 2, 1}},
+		{"tuple larger than the limit", keys(2, 5), []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := ChunkKeySet(tt.keys)
+			sizes := []int(nil)
+			for _, chunk := range chunks {
+				sizes = append(sizes, len(chunk))
+			}
+			if !reflect.DeepEqual(sizes, tt.chunks) {
+				t.Errorf("got chunks %v, want %v", sizes, tt.chunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/params"
+	"github.com/gin-gonic/gin"
+)
+
+// QueryLimits bounds the cost of the queries built by QueryMap, zero values disable the corresponding limit
+type QueryLimits struct {
+	// Maximum number of rows of a page, unpaginated requests returning more rows fail (streams included)
+	MaxRows int
+	// Maximum depth of the nested relations (eg. >A.>B has depth 2)
+	MaxDepth int
+	// Maximum number of relations joined by the queries, nested queries included
+	MaxRelations int
+	// Maximum number of conditions of params and p
+	MaxConditions int
+	// Maximum duration of the statements, the queries are cancelled when it expires
+	Timeout time.Duration
+}
+
+// DefaultQueryLimits are the limits used by the controllers and configs without their own
+var DefaultQueryLimits = QueryLimits{}
+
+// QueryLimits returns the limits of the config, DefaultQueryLimits if not set
+func (config QueryMapConfig) QueryLimits() QueryLimits {
+	if config.Limits != nil {
+		return *config.Limits
+	}
+	return DefaultQueryLimits
+}
+
+// CheckQueryLimits verifies the requested page size, nesting depth, joined relations and conditions against the limits
+func CheckQueryLimits(c *gin.Context, args *QueryMapArgs, conds *params.Conditions, limits QueryLimits) message.Message {
+	if limits.MaxRows > 0 && !args.byPrimaries() {
+		var limit int
+		if args.Cursor {
+			limit = GetLimit("", args.PagEnd)
+		} else if ShouldPaginate(args.PagStart, args.PagEnd) {
+			limit = GetLimit(args.PagStart, args.PagEnd)
+		}
+		if limit > limits.MaxRows {
+			return message.PageSizeTooLarge(c, limits.MaxRows)
+		}
+	}
+	if limits.MaxDepth > 0 && NestedDepth(&args.Info) > limits.MaxDepth {
+		return message.NestingTooDeep(c, limits.MaxDepth)
+	}
+	if limits.MaxRelations > 0 && JoinedRelations(&args.Info, conds) > limits.MaxRelations {
+		return message.TooManyRelations(c, limits.MaxRelations)
+	}
+	if limits.MaxConditions > 0 && params.CountConditions(args.Params, args.P) > limits.MaxConditions {
+		return message.TooManyConditions(c, limits.MaxConditions)
+	}
+	return nil
+}
+
+// NestedDepth returns the maximum depth of the nested relations of the model
+func NestedDepth(info *ModelInfo) int {
+	depth := 0
+	for _, nested := range info.Nested {
+		if d := NestedDepth(nested.ModelInfo) + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// JoinedRelations returns the number of relations joined by the query of the model and by the queries of its nested relations
+func JoinedRelations(info *ModelInfo, conds *params.Conditions) int {
+	var nestedConds map[string]*params.Conditions
+	if conds != nil {
+		nestedConds = conds.Nested
+	}
+	joins := map[string]struct{}{}
+	for rel := range RelationsFromModelInfo(info, nestedConds) {
+		// Every piece of the path is a join (eg. A.B joins A and A.B)
+		pieces := strings.Split(rel, ".")
+		for i := range pieces {
+			joins[strings.Join(pieces[:i+1], ".")] = struct{}{}
+		}
+	}
+	count := len(joins)
+	for relName, nested := range info.Nested {
+		count += JoinedRelations(nested.ModelInfo, nestedConds[relName])
+	}
+	return count
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"strconv"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -27,16 +28,28 @@ func GetLimit(pagStart, pagEnd string) int {
 	return end - GetOffset(pagStart)
 }
 
+// Count counts the rows returned by the query, distinct and grouped queries are counted as a subquery
 func Count(count *int64) func(*gorm.DB) *gorm.DB {
 	return func(d *gorm.DB) *gorm.DB {
-		if d.Statement.Distinct {
+		_, grouped := d.Statement.Clauses[clause.GroupBy{}.Name()]
+		if d.Statement.Distinct || grouped {
 			n := clause.OrderBy{}.Name()
 			ord := d.Statement.Clauses[n]
 			delete(d.Statement.Clauses, n)
-			d.Session(&gorm.Session{}).Raw("SELECT COUNT(1) FROM (?) AS T", d).Scan(count)
+			start := time.Now()
+			res := d.Session(&gorm.Session{}).Raw("SELECT COUNT(1) FROM (?) AS T", d).Scan(count)
+			recordQuery(res, start, 1)
+			if res.Error != nil {
+				d.AddError(res.Error)
+			}
 			d.Statement.Clauses[n] = ord
 		} else {
-			d.Session(&gorm.Session{}).Count(count)
+			start := time.Now()
+			res := d.Session(&gorm.Session{}).Count(count)
+			recordQuery(res, start, 1)
+			if res.Error != nil {
+				d.AddError(res.Error)
+			}
 		}
 		return d
 	}
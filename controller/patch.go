@@ -0,0 +1,677 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Content types of the patch documents accepted by Patch
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// PatchOperation is an operation of a JSON Patch document (RFC 6902)
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from"`
+	Value any    `json:"value"`
+}
+
+/*
+PatchDocumentToDb applies the patch document of the body to the record identified by the path params and updates it as
+UpdateVersionToDb. The version is read from the If-Match header or from the $version member of a merge patch, before
+the document is applied. The record is read locked in the transaction of the update, so the test operations still hold
+when it's written.
+*/
+func PatchDocumentToDb(c *gin.Context, mdl any, primaryFields []string, data []byte) {
+	version := LoadVersion(c, mdl, data)
+	if c.IsAborted() {
+		return
+	}
+	db := c.MustGet("db").(*gorm.DB).Session(&gorm.Session{CreateBatchSize: 50})
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+
+	values := map[string]any{}
+	err = db.Session(&gorm.Session{FullSaveAssociations: true, SkipDefaultTransaction: true}).Transaction(func(tx *gorm.DB) error {
+		body := ApplyPatchDocument(c, tx, reflect.New(modelSchema.ModelType).Interface(), primaryFields, data)
+		LoadModel(c, body, mdl)
+		GetPathParams(c, mdl, primaryFields, mdl)
+		LoadAndValidateMap(c, body, values, modelSchema.ModelType)
+		GetPathParams(c, mdl, primaryFields, &values)
+		if c.IsAborted() {
+			return errors.New("rollback")
+		}
+		if msg := CheckModelPermissions(c, reflect.Indirect(reflect.ValueOf(mdl)), modelSchema, map[string]struct{}{}, true); msg != nil {
+			msg.Abort(c)
+			return msg
+		}
+		return updateModel(c, tx, mdl, values, version, modelSchema)
+	})
+	if c.IsAborted() {
+		return
+	} else if errors.Is(err, errVersionConflict) {
+		WriteVersionConflict(c, db, mdl)
+		return
+	} else if AbortIfError(c, err) {
+		return
+	}
+	WriteModelsResult(c, db, mdl)
+}
+
+/*
+ApplyPatchDocument applies the JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) document to the record identified
+by the path params, and returns the body of Patch with the resulting changes: the changed fields of the record and,
+for its has-one and has-many relations, the new and changed items and the removed ones marked with $delete.
+The record is read locked when db is a transaction, see dialect.Dialect.LockRows.
+*/
+func ApplyPatchDocument(c *gin.Context, db *gorm.DB, mdl any, primaryFields []string, data []byte) []byte {
+	GetPathParams(c, mdl, primaryFields, mdl)
+	if c.IsAborted() {
+		return nil
+	}
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return nil
+	}
+
+	var patch any
+	var ops []PatchOperation
+	preloads := map[string]*schema.Schema{}
+	if c.ContentType() == JSONPatchContentType {
+		if err := decodeJSON(data, &ops); err != nil {
+			message.InvalidJSON(c).Text(err.Error()).Abort(c)
+			return nil
+		}
+		for _, op := range ops {
+			for _, path := range []string{op.Path, op.From} {
+				tokens, _ := parsePointer(path)
+				pointerPreloads(modelSchema, "", tokens, preloads)
+			}
+		}
+	} else {
+		if err := decodeJSON(data, &patch); err != nil {
+			message.InvalidJSON(c).Text(err.Error()).Abort(c)
+			return nil
+		}
+		mergePreloads(modelSchema, "", patch, preloads)
+	}
+
+	original, msg := loadPatchDocument(c, db, mdl, modelSchema, preloads)
+	if msg != nil {
+		msg.Abort(c)
+		return nil
+	}
+	var patched any
+	if ops != nil {
+		// The operations are applied to a copy, the original is needed by the diff
+		copied, _ := deepCopyJSON(original)
+		patched, msg = applyJSONPatch(c, copied, ops)
+	} else {
+		copied, _ := deepCopyJSON(original)
+		patched = applyMergePatch(copied, patch)
+	}
+	if msg != nil {
+		msg.Abort(c)
+		return nil
+	}
+	patchedMap, ok := patched.(map[string]any)
+	if !ok {
+		message.InvalidPatchPath(c, "").Abort(c)
+		return nil
+	}
+
+	body, msg := patchBody(c, modelSchema, original.(map[string]any), patchedMap, false)
+	if msg != nil {
+		msg.Abort(c)
+		return nil
+	}
+	result, _ := json.Marshal(body)
+	return result
+}
+
+func decodeJSON(data []byte, dest any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(dest)
+}
+
+func deepCopyJSON(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied any
+	return copied, decodeJSON(data, &copied)
+}
+
+// loadPatchDocument reads and locks the record with the relations touched by the patch, excluding the soft deleted ones
+func loadPatchDocument(c *gin.Context, db *gorm.DB, mdl any, modelSchema *schema.Schema, preloads map[string]*schema.Schema) (any, message.Message) {
+	q := dialect.For(db)
+	tx := q.LockRows(db.Session(&gorm.Session{NewDB: true}).Model(mdl), modelSchema.Table)
+	if query, args := NotDeletedCondition(q, mdl, modelSchema, modelSchema.Table); query != "" {
+		tx = tx.Where(query, args...)
+	}
+	for path, relSchema := range preloads {
+		relSchema := relSchema
+		tx = tx.Preload(path, func(d *gorm.DB) *gorm.DB {
+			if query, args := NotDeletedCondition(q, reflect.New(relSchema.ModelType).Interface(), relSchema, relSchema.Table); query != "" {
+				d = d.Where(query, args...)
+			}
+			// The indexes of the JSON Patch paths refer to the items in this order
+			if relSchema.PrioritizedPrimaryField != nil {
+				d = d.Order(clause.OrderByColumn{Column: clause.Column{Table: relSchema.Table, Name: relSchema.PrioritizedPrimaryField.DBName}})
+			}
+			return d
+		})
+	}
+	if err := tx.Take(mdl).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, message.ItemNotFound(c)
+	} else if err != nil {
+		return nil, message.InternalServerError(c)
+	}
+	data, err := json.Marshal(mdl)
+	if err != nil {
+		return nil, message.InternalServerError(c)
+	}
+	var document any
+	if err := decodeJSON(data, &document); err != nil {
+		return nil, message.InternalServerError(c)
+	}
+	return document, nil
+}
+
+// jsonFields returns the fields of the schema by their names in JSON
+func jsonFields(modelSchema *schema.Schema) map[string]*schema.Field {
+	fields := map[string]*schema.Field{}
+	for _, field := range modelSchema.Fields {
+		name := field.Name
+		if tag := strings.Split(field.StructField.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// pointerPreloads adds the relations of the path of a JSON Patch operation to the preloads
+func pointerPreloads(modelSchema *schema.Schema, prefix string, tokens []string, preloads map[string]*schema.Schema) {
+	for i := 0; i < len(tokens); i++ {
+		field := jsonFields(modelSchema)[tokens[i]]
+		if field == nil {
+			return
+		}
+		rel := modelSchema.Relationships.Relations[field.Name]
+		if rel == nil {
+			return
+		}
+		if len(prefix) > 0 {
+			prefix += "."
+		}
+		prefix += field.Name
+		preloads[prefix] = rel.FieldSchema
+		modelSchema = rel.FieldSchema
+		if rel.Type == schema.HasMany || rel.Type == schema.Many2Many {
+			// Skips the index of the item
+			i++
+		}
+	}
+}
+
+// mergePreloads adds the relations of the members of a JSON Merge Patch document to the preloads
+func mergePreloads(modelSchema *schema.Schema, prefix string, patch any, preloads map[string]*schema.Schema) {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return
+	}
+	fields := jsonFields(modelSchema)
+	for name, value := range members {
+		field := fields[name]
+		if field == nil {
+			continue
+		}
+		rel := modelSchema.Relationships.Relations[field.Name]
+		if rel == nil {
+			continue
+		}
+		path := field.Name
+		if len(prefix) > 0 {
+			path = prefix + "." + path
+		}
+		preloads[path] = rel.FieldSchema
+		if items, ok := value.([]any); ok {
+			for _, item := range items {
+				mergePreloads(rel.FieldSchema, path, item, preloads)
+			}
+		} else {
+			mergePreloads(rel.FieldSchema, path, value, preloads)
+		}
+	}
+}
+
+// applyMergePatch applies the JSON Merge Patch to the target (RFC 7396)
+func applyMergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	result, ok := target.(map[string]any)
+	if !ok {
+		result = map[string]any{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(result, name)
+		} else {
+			result[name] = applyMergePatch(result[name], value)
+		}
+	}
+	return result
+}
+
+// parsePointer splits the JSON Pointer in its reference tokens (RFC 6901)
+func parsePointer(pointer string) ([]string, bool) {
+	if pointer == "" {
+		return []string{}, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, true
+}
+
+// arrayIndex parses the index of an array of length n, "-" (the end) is accepted when adding
+func arrayIndex(token string, n int, adding bool) (int, bool) {
+	if adding && token == "-" {
+		return n, true
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (!adding && i == n) {
+		return 0, false
+	}
+	return i, true
+}
+
+func pointerGet(doc any, tokens []string) (any, bool) {
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[token]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, ok := arrayIndex(token, len(v), false)
+			if !ok {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// pointerUpdate applies fn to the container of the last token, returning the updated document
+func pointerUpdate(doc any, tokens []string, fn func(container any, token string) (any, bool)) (any, bool) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		child, ok := v[tokens[0]]
+		if !ok {
+			return nil, false
+		}
+		if v[tokens[0]], ok = pointerUpdate(child, tokens[1:], fn); !ok {
+			return nil, false
+		}
+		return v, true
+	case []any:
+		i, ok := arrayIndex(tokens[0], len(v), false)
+		if !ok {
+			return nil, false
+		}
+		if v[i], ok = pointerUpdate(v[i], tokens[1:], fn); !ok {
+			return nil, false
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+func pointerAdd(doc any, tokens []string, value any) (any, bool) {
+	if len(tokens) == 0 {
+		return value, true
+	}
+	return pointerUpdate(doc, tokens, func(container any, token string) (any, bool) {
+		switch v := container.(type) {
+		case map[string]any:
+			v[token] = value
+			return v, true
+		case []any:
+			i, ok := arrayIndex(token, len(v), true)
+			if !ok {
+				return nil, false
+			}
+			return append(v[:i], append([]any{value}, v[i:]...)...), true
+		}
+		return nil, false
+	})
+}
+
+func pointerRemove(doc any, tokens []string) (any, bool) {
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	return pointerUpdate(doc, tokens, func(container any, token string) (any, bool) {
+		switch v := container.(type) {
+		case map[string]any:
+			if _, ok := v[token]; !ok {
+				return nil, false
+			}
+			delete(v, token)
+			return v, true
+		case []any:
+			i, ok := arrayIndex(token, len(v), false)
+			if !ok {
+				return nil, false
+			}
+			return append(v[:i], v[i+1:]...), true
+		}
+		return nil, false
+	})
+}
+
+// applyJSONPatch applies the operations of the JSON Patch to the document (RFC 6902), stopping at the first failure
+func applyJSONPatch(c *gin.Context, doc any, ops []PatchOperation) (any, message.Message) {
+	for _, op := range ops {
+		path, ok := parsePointer(op.Path)
+		if !ok {
+			return nil, message.InvalidPatchPath(c, op.Path)
+		}
+		switch op.Op {
+		case "add":
+			doc, ok = pointerAdd(doc, path, op.Value)
+		case "remove":
+			doc, ok = pointerRemove(doc, path)
+		case "replace":
+			if _, ok = pointerGet(doc, path); ok {
+				if len(path) > 0 {
+					doc, ok = pointerRemove(doc, path)
+				}
+				if ok {
+					doc, ok = pointerAdd(doc, path, op.Value)
+				}
+			}
+		case "move", "copy":
+			from, valid := parsePointer(op.From)
+			if !valid {
+				return nil, message.InvalidPatchPath(c, op.From)
+			}
+			if op.Op == "move" && strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				// A location can't be moved into one of its children
+				return nil, message.InvalidPatchPath(c, op.Path)
+			}
+			var value any
+			if value, ok = pointerGet(doc, from); !ok {
+				return nil, message.InvalidPatchPath(c, op.From)
+			}
+			if op.Op == "copy" {
+				value, _ = deepCopyJSON(value)
+			} else if doc, ok = pointerRemove(doc, from); !ok {
+				return nil, message.InvalidPatchPath(c, op.From)
+			}
+			doc, ok = pointerAdd(doc, path, value)
+		case "test":
+			var value any
+			if value, ok = pointerGet(doc, path); ok && !jsonEqual(value, op.Value) {
+				return nil, message.PatchTestFailed(c, op.Path)
+			}
+		default:
+			return nil, message.InvalidPatchOperation(c, op.Op)
+		}
+		if !ok {
+			return nil, message.InvalidPatchPath(c, op.Path)
+		}
+	}
+	return doc, nil
+}
+
+// jsonEqual compares two decoded JSON values, the numbers by their value
+func jsonEqual(a, b any) bool {
+	switch va := a.(type) {
+	case json.Number:
+		vb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := va.Float64()
+		fb, errB := vb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	case map[string]any:
+		vb, ok := b.(map[string]any)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			if w, ok := vb[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		vb, ok := b.([]any)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !jsonEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+/*
+patchBody returns the body of Patch turning original into patched: the changed fields (all the fields when full is set,
+as required by the items of the relations) and the changes of the has-one and has-many relations.
+*/
+func patchBody(c *gin.Context, modelSchema *schema.Schema, original, patched map[string]any, full bool) (map[string]any, message.Message) {
+	body := map[string]any{}
+	for name, field := range jsonFields(modelSchema) {
+		oldValue, wasSet := original[name]
+		newValue, isSet := patched[name]
+		if rel := modelSchema.Relationships.Relations[field.Name]; rel != nil {
+			var value any
+			var msg message.Message
+			switch rel.Type {
+			case schema.HasMany:
+				value, msg = patchItems(c, name, rel, oldValue, newValue)
+			case schema.HasOne:
+				value, msg = patchItem(c, name, rel, oldValue, newValue)
+			default:
+				if isSet && !jsonEqual(oldValue, newValue) {
+					value = newValue
+				}
+			}
+			if msg != nil {
+				return nil, msg
+			}
+			if value != nil {
+				body[name] = value
+			}
+			continue
+		}
+		if field.DBName == "" {
+			continue
+		}
+		if full || field.PrimaryKey {
+			if isSet {
+				body[name] = newValue
+			}
+		} else if !isSet {
+			if wasSet {
+				// The removed members are set to NULL
+				body[name] = nil
+			}
+		} else if !jsonEqual(oldValue, newValue) {
+			body[name] = newValue
+		}
+	}
+	return body, nil
+}
+
+// itemKey returns the primary keys of the item of a relation, false if any of them is missing
+func itemKey(relSchema *schema.Schema, item map[string]any) (string, bool) {
+	fields := jsonFields(relSchema)
+	keys := []string{}
+	for name, field := range fields {
+		if field.PrimaryKey {
+			if item[name] == nil {
+				return "", false
+			}
+			keys = append(keys, name+"="+stringifyKey(item[name]))
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "&"), len(keys) > 0
+}
+
+// stringifyKey returns the key as a string, the numbers by their value
+func stringifyKey(value any) string {
+	if number, ok := value.(json.Number); ok {
+		if f, err := number.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// deletedItem returns the item marking for deletion the record of the relation
+func deletedItem(c *gin.Context, relName string, rel *schema.Relationship, item map[string]any) (map[string]any, message.Message) {
+	deleteField, ok := rel.FieldSchema.ModelType.FieldByName("Delete")
+	if !ok {
+		return nil, message.RelationItemsNotRemovable(c, relName)
+	}
+	deleted := map[string]any{strings.Split(deleteField.Tag.Get("json"), ",")[0]: true}
+	for name, field := range jsonFields(rel.FieldSchema) {
+		if field.PrimaryKey {
+			deleted[name] = item[name]
+		}
+	}
+	return deleted, nil
+}
+
+// patchItems returns the new, changed and removed items of a has-many relation
+func patchItems(c *gin.Context, relName string, rel *schema.Relationship, oldValue, newValue any) (any, message.Message) {
+	oldItems, _ := oldValue.([]any)
+	newItems, ok := newValue.([]any)
+	if newValue != nil && !ok {
+		return nil, message.InvalidParamType(c, relName, "array")
+	}
+	originals := map[string]map[string]any{}
+	for _, item := range oldItems {
+		if m, ok := item.(map[string]any); ok {
+			if key, ok := itemKey(rel.FieldSchema, m); ok {
+				originals[key] = m
+			}
+		}
+	}
+
+	items := []any{}
+	kept := map[string]struct{}{}
+	for _, item := range newItems {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, message.InvalidParamType(c, relName, "object")
+		}
+		original := map[string]any{}
+		if key, ok := itemKey(rel.FieldSchema, m); ok && originals[key] != nil {
+			kept[key] = struct{}{}
+			if jsonEqual(originals[key], m) {
+				continue
+			}
+			original = originals[key]
+		}
+		changed, msg := patchBody(c, rel.FieldSchema, original, m, true)
+		if msg != nil {
+			return nil, msg
+		}
+		items = append(items, changed)
+	}
+	for _, item := range oldItems {
+		m, _ := item.(map[string]any)
+		if key, ok := itemKey(rel.FieldSchema, m); ok {
+			if _, ok := kept[key]; !ok {
+				deleted, msg := deletedItem(c, relName, rel, m)
+				if msg != nil {
+					return nil, msg
+				}
+				items = append(items, deleted)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items, nil
+}
+
+// patchItem returns the changes of a has-one relation, nil if it's unchanged
+func patchItem(c *gin.Context, relName string, rel *schema.Relationship, oldValue, newValue any) (any, message.Message) {
+	if jsonEqual(oldValue, newValue) {
+		return nil, nil
+	}
+	oldItem, _ := oldValue.(map[string]any)
+	newItem, ok := newValue.(map[string]any)
+	if newValue != nil && !ok {
+		return nil, message.InvalidParamType(c, relName, "object")
+	}
+	if newItem == nil {
+		if oldItem == nil {
+			return nil, nil
+		}
+		return deletedItem(c, relName, rel, oldItem)
+	}
+	original := map[string]any{}
+	if oldItem != nil {
+		oldKey, oldOk := itemKey(rel.FieldSchema, oldItem)
+		if newKey, ok := itemKey(rel.FieldSchema, newItem); ok && oldOk && newKey == oldKey {
+			original = oldItem
+		}
+	}
+	return patchBody(c, rel.FieldSchema, original, newItem, true)
+}
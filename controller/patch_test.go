@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPatchDocumentToDbVersion(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testVersioned{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testVersioned{ID: 1, NAME: "a", VERSION: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		ifMatch     string
+		body        string
+		status      int
+		version     int64
+	}{
+		{"merge patch with $version", MergePatchContentType, "", `{"$version":7,"NAME":"b"}`, http.StatusOK, 8},
+		{"merge patch without version", MergePatchContentType, "", `{"NAME":"c"}`, http.StatusPreconditionRequired, 8},
+		{"merge patch with stale $version", MergePatchContentType, "", `{"$version":7,"NAME":"c"}`, http.StatusConflict, 8},
+		{"json patch without If-Match", JSONPatchContentType, "", `[{"op":"replace","path":"/NAME","value":"c"}]`, http.StatusPreconditionRequired, 8},
+		{"json patch with If-Match", JSONPatchContentType, `"8"`, `[{"op":"test","path":"/NAME","value":"b"},{"op":"replace","path":"/NAME","value":"c"}]`, http.StatusOK, 9},
+		{"failed test", JSONPatchContentType, `"9"`, `[{"op":"test","path":"/NAME","value":"b"},{"op":"replace","path":"/NAME","value":"d"}]`, http.StatusConflict, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newTestContext(db, "/")
+			c.Request = httptest.NewRequest(http.MethodPatch, "/1", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+			c.Params = gin.Params{{Key: "ID", Value: "1"}}
+			PatchDocumentToDb(c, &testVersioned{}, []string{"ID"}, []byte(tt.body))
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			stored := testVersioned{}
+			if err := db.Take(&stored, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.VERSION != tt.version {
+				t.Errorf("got version %d, want %d", stored.VERSION, tt.version)
+			}
+		})
+	}
+}
+
+// decodeTestJSON decodes the JSON as the patch documents are decoded, failing the test if it's invalid
+func decodeTestJSON(t *testing.T, data string) any {
+	var value any
+	if err := decodeJSON([]byte(data), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		result string
+	}{
+		{"replace", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"remove", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"nested", `{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":1}}`, `{"a":{"b":"c","f":1}}`},
+		{"array replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"object on scalar", `{"a":"b"}`, `{"a":{"c":null,"d":1}}`, `{"a":{"d":1}}`},
+		{"not an object", `{"a":"b"}`, `["c"]`, `["c"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyMergePatch(decodeTestJSON(t, tt.target), decodeTestJSON(t, tt.patch))
+			if want := decodeTestJSON(t, tt.result); !jsonEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := `{"NAME":"a","Items":[{"ID":1},{"ID":2}]}`
+	tests := []struct {
+		name   string
+		ops    string
+		result string
+		status int
+	}{
+		{"add member", `[{"op":"add","path":"/NOTE","value":"b"}]`, `{"NAME":"a","NOTE":"b","Items":[{"ID":1},{"ID":2}]}`, 0},
+		{"append item", `[{"op":"add","path":"/Items/-","value":{"ID":3}}]`, `{"NAME":"a","Items":[{"ID":1},{"ID":2},{"ID":3}]}`, 0},
+		{"insert item", `[{"op":"add","path":"/Items/0","value":{"ID":3}}]`, `{"NAME":"a","Items":[{"ID":3},{"ID":1},{"ID":2}]}`, 0},
+		{"remove item", `[{"op":"remove","path":"/Items/0"}]`, `{"NAME":"a","Items":[{"ID":2}]}`, 0},
+		{"replace", `[{"op":"replace","path":"/Items/1/ID","value":5}]`, `{"NAME":"a","Items":[{"ID":1},{"ID":5}]}`, 0},
+		{"move", `[{"op":"move","from":"/Items/0","path":"/Items/1"}]`, `{"NAME":"a","Items":[{"ID":2},{"ID":1}]}`, 0},
+		{"copy", `[{"op":"copy","from":"/NAME","path":"/NOTE"}]`, `{"NAME":"a","NOTE":"a","Items":[{"ID":1},{"ID":2}]}`, 0},
+		{"test", `[{"op":"test","path":"/Items/1/ID","value":2.0},{"op":"remove","path":"/NAME"}]`, `{"Items":[{"ID":1},{"ID":2}]}`, 0},
+		{"escaped pointer", `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"NAME":"a","a/b~c":1,"Items":[{"ID":1},{"ID":2}]}`, 0},
+		{"failed test", `[{"op":"test","path":"/NAME","value":"b"}]`, "", http.StatusConflict},
+		{"missing path", `[{"op":"remove","path":"/NOTE"}]`, "", http.StatusUnprocessableEntity},
+		{"index out of range", `[{"op":"replace","path":"/Items/2","value":{}}]`, "", http.StatusUnprocessableEntity},
+		{"leading zero index", `[{"op":"remove","path":"/Items/01"}]`, "", http.StatusUnprocessableEntity},
+		{"move into child", `[{"op":"move","from":"/Items","path":"/Items/0"}]`, "", http.StatusUnprocessableEntity},
+		{"invalid pointer", `[{"op":"add","path":"NOTE","value":1}]`, "", http.StatusUnprocessableEntity},
+		{"invalid operation", `[{"op":"merge","path":"/NOTE"}]`, "", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []PatchOperation
+			if err := decodeJSON([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			c, _ := newTestContext(nil, "/")
+			got, msg := applyJSONPatch(c, decodeTestJSON(t, doc), ops)
+			if tt.status != 0 {
+				if msg == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				if status := msg.(*message.Msg).Status; status != tt.status {
+					t.Errorf("got status %d, want %d", status, tt.status)
+				}
+				return
+			}
+			if msg != nil {
+				t.Fatal(msg)
+			}
+			if want := decodeTestJSON(t, tt.result); !jsonEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
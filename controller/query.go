@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/Datosystem/go_api_core/model"
 	"github.com/Datosystem/go_api_core/params"
@@ -25,13 +29,33 @@ type QueryMapArgs struct {
 	PagStart  string
 	PagEnd    string
 	Ord       string
+	Group     string
+	Q         string
+	Rank      bool
+	After     string
+	Cursor    bool
 	Primaries map[string]interface{}
+	// PrimaryKeys selects the rows by the tuples of their primary keys, in the order of the primary fields of the schema.
+	// As with Primaries the rows aren't ordered, paginated nor limited
+	PrimaryKeys [][]any
+	// CountOnly runs only the count of the rows, set in Count, without reading them
+	CountOnly bool
+	// Stream, when set, receives the root rows in chunks (with their nested relations already loaded)
+	// as soon as they are read, instead of collecting them in Result
+	Stream func(rows []map[string]any) error `json:"-"`
 	// Model
 	Model any
 	// Output
-	Info   ModelInfo
-	Result []map[string]any
-	Count  int64
+	Info       ModelInfo
+	Result     []map[string]any
+	Count      int64
+	NextCursor string
+	// Debug is config.Debug, the queries recorded by QueryMap
+	Debug *QueryDebug `json:"-"`
+
+	cursorKeys   []string
+	cursorValues []any
+	streamed     int64
 }
 
 type QueryMapConfig struct {
@@ -40,6 +64,21 @@ type QueryMapConfig struct {
 	SkipDefaults   bool
 	P              map[string]struct{}
 	Ord            map[string]struct{}
+	// Number of parent rows whose nested relations are loaded with a single query, DefaultChunkSize if not set
+	ChunkSize int
+	// Limits of the query cost, DefaultQueryLimits if not set
+	Limits *QueryLimits
+	// Debug, when set, collects the executed queries
+	Debug *QueryDebug
+	// IncludeDeleted disables the exclusion of the soft deleted records (see model.SoftDeleteModel)
+	IncludeDeleted bool
+}
+
+const DefaultChunkSize = 1000
+
+// byPrimaries reports whether the rows are selected by their primary keys, see Primaries and PrimaryKeys
+func (args *QueryMapArgs) byPrimaries() bool {
+	return len(args.Primaries) != 0 || len(args.PrimaryKeys) != 0
 }
 
 func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapConfig) error {
@@ -59,9 +98,10 @@ func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapCo
 	// Obtain all the relations from the arguments
 	// TODO: Extract and validate relations here
 
+	d := dialect.For(db)
 	computedFields := map[string]string{}
 	args.Info = ModelInfo{Select: []string{}, SelectArgs: []any{}, Relations: map[string]*params.Conditions{}, Nested: map[string]NestedModel{}, Schema: modelSchema}
-	msg := GetModelInfo(c, modelSchema, getSelect(args.Sel, args.Rel), computedFields, &args.Info, args)
+	msg := GetModelInfo(c, d, modelSchema, getSelect(args.Sel, args.Rel), computedFields, &args.Info, args)
 	if msg != nil {
 		return msg
 	}
@@ -75,10 +115,17 @@ func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapCo
 	}
 
 	conds := params.Conditions{Nested: map[string]*params.Conditions{}}
-	err = params.ToStmt(c, args.Params, args.P, modelSchema, args.Info.Table, &conds, config.P)
+	err = params.ToStmt(c, d, args.Params, args.P, modelSchema, args.Info.Table, &conds, config.P)
 	if err != nil {
 		return err
 	}
+	if len(args.Q) > 0 {
+		// The rank can't be used to order distinct or grouped rows, nor with cursors
+		rank := args.Rank && !args.Info.Distinct && !args.Info.Aggregate && !args.Cursor
+		if msg := params.Search(c, d, modelSchema, args.Info.Table, args.Q, rank, &conds); msg != nil {
+			return msg
+		}
+	}
 	if !config.SkipValidation {
 		if err := validateRelations(c, modelSchema, args.Info.Nested); err != nil {
 			return err
@@ -88,6 +135,11 @@ func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapCo
 		}
 	}
 
+	limits := config.QueryLimits()
+	if msg := CheckQueryLimits(c, args, &conds, limits); msg != nil {
+		return msg
+	}
+
 	if args.Ord != "" && config.Ord != nil {
 		orders := strings.Split(args.Ord, ",")
 		order := []string{}
@@ -101,13 +153,68 @@ func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapCo
 		args.Ord = strings.Join(order, ",")
 	}
 
+	if args.Cursor && !args.byPrimaries() {
+		if args.Stream != nil {
+			return message.ConflictingStreamAndCursor(c)
+		}
+		if len(args.PagStart) > 0 {
+			return message.ConflictingPaginationAndCursor(c)
+		}
+		if args.Info.Aggregate {
+			return message.ConflictingPaginationAndAggregation(c)
+		}
+		if GetLimit("", args.PagEnd) < 1 {
+			return message.InvalidUrlParameter(c, "pagEnd")
+		}
+		var msg message.Message
+		args.cursorKeys, msg = PrepareCursor(c, d, &args.Info, args.Ord)
+		if msg != nil {
+			return msg
+		}
+		if len(args.After) > 0 {
+			args.cursorValues, msg = DecodeCursor(c, args.After, &args.Info)
+			if msg != nil {
+				return msg
+			}
+		}
+	}
+
+	args.Debug = config.Debug
+	if config.Debug != nil {
+		db = withDebug(db, config.Debug, "")
+	}
+
+	var ctx context.Context
+	if limits.Timeout > 0 {
+		ctx = db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+		db = db.WithContext(ctx)
+	}
+
 	args.Result = []map[string]any{}
 	err = QueryMapRecursive(c, db, args, config, &args.Info, &conds, &args.Result)
 	if err != nil {
+		if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+			return message.QueryTimeout(c)
+		}
 		return err
 	}
 
-	if !ShouldPaginate(args.PagStart, args.PagEnd) {
+	if args.CountOnly {
+		return nil
+	}
+	if args.Stream != nil {
+		if !ShouldPaginate(args.PagStart, args.PagEnd) {
+			args.Count = args.streamed
+		}
+	} else if args.Cursor && !args.byPrimaries() {
+		// The total rows are counted before seeking the page, see QueryMapRecursive
+	} else if !ShouldPaginate(args.PagStart, args.PagEnd) {
 		args.Count = int64(len(args.Result))
 	}
 
@@ -119,13 +226,17 @@ func QueryMap(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapCo
 }
 
 func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapConfig, info *ModelInfo, conds *params.Conditions, result *[]map[string]any) error {
-	tx := db.Select(strings.Join(info.Select, ","), info.SelectArgs...)
+	// The nested slices limited for each parent number their rows, see windowRows
+	windowed := args == nil && (info.Offset > 0 || info.Limit > 0)
+	selects := info.Select
+	if windowed {
+		selects = windowSelects(dialect.For(db), info)
+	}
+	tx := db.Select(strings.Join(selects, ","), info.SelectArgs...)
 	tx.Statement.Distinct = info.Distinct
 	if info.Aggregate {
-		for _, field := range info.Select {
-			if !strings.HasPrefix(field, "SUM(") && !strings.HasPrefix(field, "COUNT(") {
-				tx = tx.Group(field)
-			}
+		for _, field := range info.GroupBy {
+			tx = tx.Group(field)
 		}
 	}
 
@@ -149,13 +260,26 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 			tx.Joins(model.DefaultJoins(tx, info.Table))
 		}
 	}
+	if !config.IncludeDeleted {
+		// Handles the soft deleted records
+		if query, args := NotDeletedCondition(dialect.For(db), reflect.New(info.Schema.ModelType).Interface(), info.Schema, info.Table); query != "" {
+			tx.Where(query, args...)
+		}
+	}
 
 	if len(conds.Query) > 0 {
 		tx.Where(conds.Query, conds.Args...)
 	}
+	if conds.Having != nil && len(conds.Having.Query) > 0 {
+		tx.Having(conds.Having.Query, conds.Having.Args...)
+	}
 
 	JoinRelations(c, tx, config, info, RelationsFromModelInfo(info, conds.Nested))
 
+	if args != nil && args.CountOnly {
+		return ExposeSQLErr(c, Count(&args.Count)(tx).Error)
+	}
+
 	var pagination bool
 	if args == nil {
 		tx = tx.Order(info.Order)
@@ -163,7 +287,9 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 		pagination = ShouldPaginate(args.PagStart, args.PagEnd)
 
 		order := info.Order
-		if len(args.Primaries) == 0 {
+		if !args.byPrimaries() && args.Cursor {
+			tx = tx.Scopes(Count(&args.Count), Seek(info, args.cursorValues, GetLimit("", args.PagEnd))).Order(order)
+		} else if !args.byPrimaries() {
 			// order := Order(args.Ord, db, args.Model, info)
 			// if len(args.Ord) > 0 {
 			// 	var msg message.Message
@@ -173,24 +299,44 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 			// 	}
 			// }
 
-			if info.Aggregate && pagination {
-				return message.ConflictingPaginationAndAggregation(c)
-			}
 			if info.Distinct && args.Ord == "" {
 				order = ""
 			}
 			if len(order) > 0 {
-				if !info.Aggregate && pagination {
+				if pagination {
 					tx = tx.Scopes(Count(&args.Count)).Scopes(Paginate(args.PagStart, args.PagEnd))
 				}
-				tx = tx.Order(order)
+				if conds.Rank != nil {
+					// A single expression, the columns of the order clauses don't support arguments
+					tx = tx.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "(" + conds.Rank.Query + ") DESC," + order, Vars: conds.Rank.Args}})
+				} else {
+					tx = tx.Order(order)
+				}
 			} else if pagination {
 				return message.ManualPagination(c)
 			}
+			if maxRows := config.QueryLimits().MaxRows; maxRows > 0 && !pagination {
+				// One more row to detect the results exceeding the limit
+				tx = tx.Limit(maxRows + 1)
+			}
 		} else {
-			tx = tx.Where(args.Primaries)
+			if len(args.Primaries) != 0 {
+				tx = tx.Where(args.Primaries)
+			}
+			if len(args.PrimaryKeys) != 0 {
+				d := dialect.For(db)
+				columns := make([]string, len(info.Schema.PrimaryFields))
+				for i, field := range info.Schema.PrimaryFields {
+					columns[i] = info.Table + "." + d.Quote(field.DBName)
+				}
+				query, keyArgs := KeySetCondition(columns, args.PrimaryKeys)
+				tx = tx.Where(query, keyArgs...)
+			}
 		}
 	}
+	if windowed {
+		tx = windowRows(tx, info)
+	}
 	if c.Query("SUM") == "1" {
 		n := clause.OrderBy{}.Name()
 		// ord := tx.Statement.Clauses[n]
@@ -207,13 +353,6 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 		//	tx.Statement.Clauses[n] = ord
 	}
 
-	rows, err := tx.Rows()
-	err = ExposeSQLErr(c, err)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
 	// Add the foreign key to the fields for now
 	if len(info.Select) != len(info.Fields) {
 		info.Fields = append([]reflect.StructField{{
@@ -222,54 +361,204 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 		}}, info.Fields...)
 	}
 
-	for rows.Next() {
-		if err := rows.Err(); err != nil {
+	chunkSize := config.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if args != nil && args.Stream != nil {
+		return streamRows(c, db, tx, args, config, info, conds, chunkSize)
+	}
+
+	start := time.Now()
+	read, err := readRows(c, tx, info, result)
+	recordQuery(tx, start, read)
+	if err != nil {
+		return err
+	}
+
+	if args != nil && !args.Cursor && !args.byPrimaries() && !ShouldPaginate(args.PagStart, args.PagEnd) {
+		if maxRows := config.QueryLimits().MaxRows; maxRows > 0 && len(*result) > maxRows {
+			return message.TooManyRows(c, maxRows)
+		}
+	}
+
+	if args != nil && args.Cursor && !args.byPrimaries() {
+		if limit := GetLimit("", args.PagEnd); len(*result) > limit {
+			*result = (*result)[:limit]
+			args.NextCursor = EncodeCursor((*result)[limit-1], args.cursorKeys)
+		}
+	}
+
+	for start := 0; start < len(*result); start += chunkSize {
+		end := start + chunkSize
+		if end > len(*result) {
+			end = len(*result)
+		}
+		if err := loadNested(c, db, config, info, conds, (*result)[start:end]); err != nil {
 			return err
 		}
-		rowFields := make([]any, len(info.Fields))
-		for i := 0; i < len(rowFields); i++ {
-			// t := info.Fields[i].Type
-			// if t.Kind() == reflect.Pointer {
-			// 	t = t.Elem()
-			// }
-			// switch t.Kind() {
-			// case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-			// 	rowFields[i] = new(int)
-			// case reflect.Float32, reflect.Float64:
-			// 	rowFields[i] = new(float64)
-			// case reflect.String:
-			// 	rowFields[i] = new(string)
-			// default:
-			// 	rowFields[i] = reflect.New(t).Interface()
-			// }
+	}
+	ComputeFields(c, info, *result)
 
-			t := info.Fields[i].Type
-			if t.Kind() != reflect.Pointer {
-				t = reflect.PointerTo(t)
+	return nil
+}
+
+/*
+streamRows passes the rows of the query to args.Stream in chunks, reading them with rows.Next() so that only a chunk
+is kept in memory. The nested relations of a chunk are loaded while the rows are still open, on another connection of
+the pool. Transactions and single connection pools (SQLite) can't run other queries while the rows are read, there the
+rows with nested relations are read at once and then sent in chunks. Unpaginated streams are bound by MaxRows like
+the other queries, exceeding it fails before the exceeding chunk is sent.
+*/
+func streamRows(c *gin.Context, db *gorm.DB, tx *gorm.DB, args *QueryMapArgs, config QueryMapConfig, info *ModelInfo, conds *params.Conditions, chunkSize int) error {
+	maxRows := 0
+	if !ShouldPaginate(args.PagStart, args.PagEnd) {
+		maxRows = config.QueryLimits().MaxRows
+	}
+	send := func(chunk []map[string]any) error {
+		if maxRows > 0 && args.streamed+int64(len(chunk)) > int64(maxRows) {
+			return message.TooManyRows(c, maxRows)
+		}
+		if err := loadNested(c, db, config, info, conds, chunk); err != nil {
+			return err
+		}
+		ComputeFields(c, info, chunk)
+		args.streamed += int64(len(chunk))
+		return args.Stream(chunk)
+	}
+
+	if len(info.Nested) != 0 && !concurrentReads(db) {
+		rows := []map[string]any{}
+		start := time.Now()
+		read, err := readRows(c, tx, info, &rows)
+		recordQuery(tx, start, read)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(rows); start += chunkSize {
+			end := start + chunkSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if err := send(rows[start:end]); err != nil {
+				return err
 			}
-			rowFields[i] = reflect.New(t).Interface()
 		}
+		return nil
+	}
 
-		if err := rows.Scan(rowFields...); err != nil {
+	chunk := []map[string]any{}
+	start := time.Now()
+	rows, err := tx.Rows()
+	if err != nil {
+		recordQuery(tx, start, 0)
+		return ExposeSQLErr(c, err)
+	}
+	defer rows.Close()
+	var read int64
+	for rows.Next() {
+		row, err := scanRow(rows, info)
+		if err != nil {
+			recordQuery(tx, start, read)
 			return err
 		}
+		read++
+		chunk = append(chunk, row)
+		if len(chunk) >= chunkSize {
+			if err := send(chunk); err != nil {
+				recordQuery(tx, start, read)
+				return err
+			}
+			chunk = []map[string]any{}
+		}
+	}
+	recordQuery(tx, start, read)
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(chunk) == 0 {
+		return nil
+	}
+	return send(chunk)
+}
+
+// concurrentReads reports whether other queries can run on db while the rows of a query are read: it must not be a
+// transaction and its pool must allow more than one connection
+func concurrentReads(db *gorm.DB) bool {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+	sqlDB, err := db.DB()
+	return err == nil && sqlDB.Stats().MaxOpenConnections != 1
+}
 
-		rowMap := make(map[string]any, len(info.Fields))
-		for i := 0; i < len(rowFields); i++ {
-			rowMap[info.Fields[i].Name] = reflect.ValueOf(rowFields[i]).Elem().Interface()
+// readRows appends the rows of the query to result, the rows are closed before returning
+func readRows(c *gin.Context, tx *gorm.DB, info *ModelInfo, result *[]map[string]any) (int64, error) {
+	rows, err := tx.Rows()
+	if err != nil {
+		return 0, ExposeSQLErr(c, err)
+	}
+	defer rows.Close()
+	var read int64
+	for rows.Next() {
+		row, err := scanRow(rows, info)
+		if err != nil {
+			return read, err
 		}
+		*result = append(*result, row)
+		read++
+	}
+	return read, rows.Err()
+}
+
+// scanRow reads the current row in a map of the fields of the model, the values are pointers
+func scanRow(rows *sql.Rows, info *ModelInfo) (map[string]any, error) {
+	rowFields := make([]any, len(info.Fields))
+	for i := 0; i < len(rowFields); i++ {
+		t := info.Fields[i].Type
+		if t.Kind() != reflect.Pointer {
+			t = reflect.PointerTo(t)
+		}
+		rowFields[i] = reflect.New(t).Interface()
+	}
 
-		*result = append(*result, rowMap)
+	if err := rows.Scan(rowFields...); err != nil {
+		return nil, err
 	}
 
+	rowMap := make(map[string]any, len(info.Fields))
+	for i := 0; i < len(rowFields); i++ {
+		rowMap[info.Fields[i].Name] = reflect.ValueOf(rowFields[i]).Elem().Interface()
+	}
+	return rowMap, nil
+}
+
+// ComputeFields sets the computed fields of the rows, then removes the dependencies that weren't requested
+func ComputeFields(c *gin.Context, info *ModelInfo, rows []map[string]any) {
+	if len(info.Computed) == 0 && len(info.Hidden) == 0 {
+		return
+	}
+	for _, row := range rows {
+		for _, field := range info.Computed {
+			row[field.Name] = field.Compute(c, row)
+		}
+		for name := range info.Hidden {
+			delete(row, name)
+		}
+	}
+}
+
+// loadNested loads the nested relations of the supplied rows, the parent keys are bound as parameters in chunks (see ChunkKeySet)
+func loadNested(c *gin.Context, db *gorm.DB, config QueryMapConfig, info *ModelInfo, conds *params.Conditions, result []map[string]any) error {
 	type SetContainer struct {
 		keyMap map[string][]int
-		keySet any
+		keys   [][]any
 	}
 
 	containers := map[string]SetContainer{}
 
 	for relName, rel := range info.Nested {
+		ndb := withDebugRelation(db, relName)
 		nestedConds := &params.Conditions{}
 		if conds.Nested != nil {
 			if c, ok := conds.Nested[relName]; ok && (c.Type == "N" || c.Type == "M") {
@@ -291,13 +580,9 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 			container = SetContainer{
 				keyMap: map[string][]int{},
 			}
-			if len(rel.References) == 1 {
-				container.keySet = map[string]struct{}{}
-			} else {
-				container.keySet = map[string]any{}
-			}
-			for i, r := range *result {
+			for i, r := range result {
 				keys := make([]string, len(rel.References))
+				values := make([]any, len(rel.References))
 				var keysValid bool
 				for i, ref := range rel.References {
 					var key string
@@ -309,7 +594,8 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 					val := reflect.ValueOf(r[ref.PrimaryKey.Name])
 					if val.IsValid() {
 						if !val.IsZero() {
-							key = fmt.Sprint(val.Elem().Interface())
+							values[i] = val.Elem().Interface()
+							key = fmt.Sprint(values[i])
 						}
 					} else {
 						// The field isn't defined in the map; return an error
@@ -321,31 +607,12 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 					}
 				}
 				if keysValid {
-					// Generate the keySet to use it in the next query as a filter
-					var ks any = container.keySet
-					for i, key := range keys {
-						if i == len(keys)-1 {
-							ks.(map[string]struct{})[key] = struct{}{}
-						} else if i == len(keys)-2 {
-							current := ks.(map[string]any)
-							if _, ok := current[key]; !ok {
-								m := map[string]struct{}{}
-								ks.(map[string]any)[key] = m
-							}
-							ks = current[key]
-						} else {
-							current := ks.(map[string]any)
-							if _, ok := current[key]; !ok {
-								m := map[string]any{}
-								current[key] = m
-							}
-							ks = current[key]
-						}
-					}
-					// Generate the keyMap containing row references divided by key
+					// Generate the keyMap containing row references divided by key,
+					// the values of each distinct key are used in the next query as a filter
 					valueKey := strings.Join(keys, "___")
 					if _, ok := container.keyMap[valueKey]; !ok {
 						container.keyMap[valueKey] = []int{}
+						container.keys = append(container.keys, values)
 					}
 					container.keyMap[valueKey] = append(container.keyMap[valueKey], i)
 				}
@@ -358,32 +625,58 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 			relName = relName[index+1:]
 		}
 
-		for i := range *result {
+		countName := rel.ModelInfo.CountName
+		for i := range result {
 			if rel.Slice {
-				(*result)[i][relName] = []map[string]any{}
+				result[i][relName] = []map[string]any{}
+				if rel.ModelInfo.Count {
+					result[i][countName] = int64(0)
+				}
 			} else {
-				(*result)[i][relName] = nil
+				result[i][relName] = nil
 			}
 		}
 
 		// Proceed only if there is at least one valid keyMap/condition
+		// The keys are split in chunks to respect the parameters limit, each parent key is in a single chunk
 		if len(container.keyMap) != 0 {
-			if nestedConds.Query != "" {
-				nestedConds.Query += " AND "
+			columns := make([]string, len(rel.References))
+			for i, ref := range rel.References {
+				columns[i] = rel.ModelInfo.Table + "." + dialect.For(db).Quote(ref.ForeignKey.DBName)
 			}
-			nestedConds.Query += keySetToStr(rel.ModelInfo.Table, rel.References, container.keySet)
-			rows := []map[string]any{}
-			err := QueryMapRecursive(c, db, nil, config, rel.ModelInfo, nestedConds, &rows)
-			if err != nil {
-				return err
-			}
-			for i, row := range rows {
-				for _, index := range container.keyMap[*row[fkAlias].(*string)] {
-					delete(row, fkAlias)
-					if rel.Slice {
-						(*result)[index][relName] = append((*result)[index][relName].([]map[string]any), rows[i])
-					} else {
-						(*result)[index][relName] = rows[i]
+			for _, keys := range ChunkKeySet(container.keys) {
+				query, args := KeySetCondition(columns, keys)
+				chunkConds := *nestedConds
+				if chunkConds.Query != "" {
+					chunkConds.Query = "(" + chunkConds.Query + ") AND " + query
+				} else {
+					chunkConds.Query = query
+				}
+				chunkConds.Args = append(append([]any{}, nestedConds.Args...), args...)
+				rows := []map[string]any{}
+				err := QueryMapRecursive(c, ndb, nil, config, rel.ModelInfo, &chunkConds, &rows)
+				if err != nil {
+					return err
+				}
+				for i, row := range rows {
+					for _, index := range container.keyMap[parentKey(row)] {
+						delete(row, fkAlias)
+						if rel.Slice {
+							result[index][relName] = append(result[index][relName].([]map[string]any), rows[i])
+						} else {
+							result[index][relName] = rows[i]
+						}
+					}
+				}
+				if rel.Slice && rel.ModelInfo.Count {
+					counts := []map[string]any{}
+					if err := QueryMapRecursive(c, ndb, nil, config, countModelInfo(rel.ModelInfo), &chunkConds, &counts); err != nil {
+						return err
+					}
+					for _, row := range counts {
+						for _, index := range container.keyMap[parentKey(row)] {
+							result[index][countName] = row[countSuffix]
+						}
 					}
 				}
 			}
@@ -393,6 +686,14 @@ func QueryMapRecursive(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config Q
 	return nil
 }
 
+// parentKey returns the key of the parent of a nested row, empty when it's NULL
+func parentKey(row map[string]any) string {
+	if key, ok := row[fkAlias].(*string); ok && key != nil {
+		return *key
+	}
+	return ""
+}
+
 func getSelect(sel, rel string) string {
 	if sel == "" {
 		sel = "*"
@@ -450,57 +751,6 @@ func validateRelations[T params.NextNesterer[T]](c *gin.Context, modelSchema *sc
 	return nil
 }
 
-func keySetToStr(table string, refs []*schema.Reference, vals any) string {
-	result := ""
-	if len(refs) == 1 {
-		keySet := vals.(map[string]struct{})
-		keys := make([]string, 0, len(keySet))
-		var hasNull bool
-		for key := range keySet {
-			if key == "" {
-				hasNull = true
-			} else {
-				keys = append(keys, key)
-			}
-		}
-
-		field := table + "." + refs[0].ForeignKey.DBName
-		if len(keys) != 0 {
-			if hasNull {
-				result += "("
-			}
-			result += field + " IN (" + strings.Join(keys, ",") + ")"
-		}
-		if hasNull {
-			if len(keys) != 0 {
-				result += " OR "
-			}
-			result += field + " IS NULL"
-			if len(keys) != 0 {
-				result += ")"
-			}
-		}
-	} else {
-		m := vals.(map[string]any)
-		if len(m) > 1 {
-			result += "("
-		}
-		first := true
-		for k, v := range m {
-			if first {
-				first = false
-			} else {
-				result += ") OR ("
-			}
-			result += table + "." + refs[0].ForeignKey.DBName + " = " + k + " AND " + keySetToStr(table, refs[1:], v)
-		}
-		if len(m) > 1 {
-			result += ")"
-		}
-	}
-	return result
-}
-
 func HandleComputedFields(c *gin.Context, computedFields map[string]string, data reflect.Value) {
 	if c.IsAborted() {
 		return
@@ -546,8 +796,10 @@ func parseSel(sel string) string {
 		sel = strings.TrimPrefix(sel, "DISTINCT ")
 	}
 	sel = strings.ReplaceAll(sel, " AS ", "#AS#")
+	sel = regexp.MustCompile(`\(\s*DISTINCT\s+`).ReplaceAllString(sel, "(#DISTINCT#")
 	sel = regex.ReplaceAllString(sel, "")
 	sel = strings.ReplaceAll(sel, "#AS#", " AS ")
+	sel = strings.ReplaceAll(sel, "#DISTINCT#", "DISTINCT ")
 	if distinct {
 		sel = "DISTINCT " + sel
 	}
@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type testCustomer struct {
+	ID     int `gorm:"primaryKey"`
+	NAME   string
+	Orders []testOrder `gorm:"foreignKey:CUSTOMER_ID"`
+}
+
+func (testCustomer) TableName() string {
+	return "CUSTOMERS"
+}
+
+type testOrder struct {
+	ID          int `gorm:"primaryKey"`
+	CUSTOMER_ID *int
+	AMOUNT      float64
+	NOTE        *string
+	Customer    *testCustomer `gorm:"foreignKey:ID;references:CUSTOMER_ID"`
+}
+
+func (testOrder) TableName() string {
+	return "ORDERS"
+}
+
+// newTestDB opens an in-memory SQLite database, with a single connection, containing the test customers and orders
+func newTestDB(t *testing.T) *gorm.DB {
+	return openTestDB(t, ":memory:", 1)
+}
+
+// openTestDB opens the SQLite database dsn, with at most conns connections, containing the test customers and orders
+func openTestDB(t *testing.T, dsn string, conns int) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{NamingStrategy: schema.NamingStrategy{NoLowerCase: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(conns)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&testCustomer{}, &testOrder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	one, two := 1, 2
+	note := "urgent"
+	customers := []testCustomer{{ID: 1, NAME: "Alpha"}, {ID: 2, NAME: "Beta"}, {ID: 3, NAME: "Gamma"}}
+	orders := []testOrder{
+		{ID: 1, CUSTOMER_ID: &one, AMOUNT: 10, NOTE: &note},
+		{ID: 2, CUSTOMER_ID: &one, AMOUNT: 20},
+		{ID: 3, CUSTOMER_ID: &two, AMOUNT: 30, NOTE: &note},
+		{ID: 4, AMOUNT: 40},
+	}
+	if err := db.Omit("Orders").Create(&customers).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Omit("Customer").Create(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	app.DB = db
+	return db
+}
+
+// newTestContext returns the context of a request to url on db and the recorder of its response
+func newTestContext(db *gorm.DB, url string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", url, nil)
+	c.Set("db", db)
+	c.Set("i18n", message.NewPrinter(language.English))
+	return c, w
+}
+
+// ids returns the ID of every row
+func ids(rows []map[string]any) []int {
+	result := make([]int, len(rows))
+	for i, row := range rows {
+		if id, ok := row["ID"].(*int); ok && id != nil {
+			result[i] = *id
+		}
+	}
+	return result
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueryMapSQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name string
+		args QueryMapArgs
+		ids  []int
+	}{
+		{"default select", QueryMapArgs{}, []int{1, 2, 3, 4}},
+		{"filter", QueryMapArgs{Sel: "ID,AMOUNT", P: `{"AMOUNT>=":20}`}, []int{2, 3, 4}},
+		{"joined filter", QueryMapArgs{Sel: "ID,Customer.NAME", P: `{"Customer.NAME":"Alpha"}`}, []int{1, 2}},
+		{"order", QueryMapArgs{Ord: "AMOUNT DESC"}, []int{4, 3, 2, 1}},
+		{"primaries", QueryMapArgs{Primaries: map[string]any{"ID": 3}}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			args.Model = &testOrder{}
+			c, _ := newTestContext(db, "/")
+			if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(args.Result); !equalInts(got, tt.ids) {
+				t.Errorf("got %v, want %v", got, tt.ids)
+			}
+		})
+	}
+}
+
+func TestQueryMapSQLiteNested(t *testing.T) {
+	db := newTestDB(t)
+
+	args := QueryMapArgs{Sel: "ID,NAME,>Orders[1;count].ID,>Orders.AMOUNT", Model: &testCustomer{}}
+	c, _ := newTestContext(db, "/")
+	if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(args.Result); !equalInts(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v, want [1 2 3]", got)
+	}
+	want := []struct {
+		ids   []int
+		count int64
+	}{{[]int{1}, 2}, {[]int{3}, 1}, {[]int{}, 0}}
+	for i, w := range want {
+		orders := args.Result[i]["Orders"].([]map[string]any)
+		if got := ids(orders); !equalInts(got, w.ids) {
+			t.Errorf("customer %d: got orders %v, want %v", i+1, got, w.ids)
+		}
+		if got := indirectValue(args.Result[i]["Orders"+countSuffix]); got != w.count {
+			t.Errorf("customer %d: got count %v, want %d", i+1, got, w.count)
+		}
+	}
+}
+
+func TestQueryMapGroupSQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name  string
+		args  QueryMapArgs
+		rows  int
+		fails bool
+	}{
+		{"default select", QueryMapArgs{Group: "ID,CUSTOMER_ID,AMOUNT,NOTE"}, 4, false},
+		{"aggregate", QueryMapArgs{Sel: "CUSTOMER_ID,SUM(AMOUNT) AS TOTAL", Group: "CUSTOMER_ID"}, 3, false},
+		{"joined field", QueryMapArgs{Sel: "Customer.NAME,COUNT(ID) AS N", Group: "Customer.NAME"}, 3, false},
+		{"ungrouped field", QueryMapArgs{Sel: "ID,AMOUNT", Group: "ID"}, 0, true},
+		{"ungrouped default select", QueryMapArgs{Group: "ID"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			args.Model = &testOrder{}
+			c, _ := newTestContext(db, "/")
+			err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true})
+			if tt.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args.Result) != tt.rows {
+				t.Errorf("got %d rows, want %d", len(args.Result), tt.rows)
+			}
+		})
+	}
+}
+
+func TestQueryMapSQLiteCountName(t *testing.T) {
+	db := newTestDB(t)
+
+	args := QueryMapArgs{Sel: "ID,>Orders[count=TOTAL].ID", Model: &testCustomer{}}
+	c, _ := newTestContext(db, "/")
+	if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := indirectValue(args.Result[0]["TOTAL"]); got != int64(2) {
+		t.Errorf("got count %v, want 2", got)
+	}
+
+	// The count can't overwrite a field of the parent
+	for _, sel := range []string{"ID,>Orders[count=NAME].ID", "ID,NAME AS OrdersCount,>Orders[count].ID"} {
+		args := QueryMapArgs{Sel: sel, Model: &testCustomer{}}
+		if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err == nil {
+			t.Errorf("%s: expected a conflict", sel)
+		}
+	}
+}
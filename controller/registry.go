@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/app"
 	"github.com/Datosystem/go_api_core/model"
 
 	"github.com/gin-gonic/gin"
@@ -41,16 +42,30 @@ func Register(container *gin.RouterGroup, toRegister string, r CRUDSController)
 		}
 		if strings.Contains(toRegister, "R") {
 			r.AddRoute(http.MethodGet, "", model.PermissionsGet(r.GetModel()), r.Get)
+			r.AddRoute(http.MethodHead, "", model.PermissionsGet(r.GetModel()), r.Get)
 			if len(primaryFields) > 0 {
 				r.AddRoute(http.MethodGet, params, model.PermissionsGet(r.GetModel()), r.GetOne)
+				r.AddRoute(http.MethodHead, params, model.PermissionsGet(r.GetModel()), r.GetOne)
+				r.AddRoute(http.MethodGet, params+"/history", model.PermissionsHistory(r.GetModel()), r.History)
 			}
 		}
 		if strings.Contains(toRegister, "U") && len(primaryFields) > 0 {
 			r.AddRoute(http.MethodPatch, params, model.PermissionsPatch(r.GetModel()), r.Patch)
 			r.AddRoute(http.MethodPatch, "", model.PermissionsPatch(r.GetModel()), r.PatchMany)
 		}
+		if strings.Contains(toRegister, "P") && len(primaryFields) > 0 {
+			r.AddRoute(http.MethodPut, params, model.PermissionsPost(r.GetModel()), r.Put)
+			r.AddRoute(http.MethodPut, "", model.PermissionsPost(r.GetModel()), r.Put)
+		}
 		if strings.Contains(toRegister, "D") && len(primaryFields) > 0 {
 			r.AddRoute(http.MethodDelete, params, model.PermissionsDelete(r.GetModel()), r.Delete)
+			r.AddRoute(http.MethodDelete, "", model.PermissionsDelete(r.GetModel()), r.DeleteMany)
+			if _, ok := r.GetModel().(model.SoftDeleteModel); ok {
+				r.AddRoute(http.MethodPost, params+"/restore", model.PermissionsRestore(r.GetModel()), r.Restore)
+			}
+		}
+		if r.CanImport() {
+			r.AddRoute(http.MethodPost, "import", model.PermissionsPost(r.GetModel()), r.Import)
 		}
 		if strings.Contains(toRegister, "S") {
 			r.AddRoute(http.MethodGet, "structure", model.PermissionsGet(r.GetModel()), r.GetStructure)
@@ -69,7 +84,7 @@ func Register(container *gin.RouterGroup, toRegister string, r CRUDSController)
 	grp := container.Group(name)
 
 	for _, route := range r.GetRoutes() {
-		funcs := []gin.HandlerFunc{}
+		funcs := []gin.HandlerFunc{setController(controllerName)}
 		if route.PermissionsFunc != nil {
 			funcs = append(funcs, checkPermissions(route.PermissionsFunc))
 		}
@@ -92,3 +107,9 @@ func checkPermissions(permissionFunc model.PermissionFunc) gin.HandlerFunc {
 		}
 	}
 }
+
+func setController(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(app.ControllerKey, name)
+	}
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Datosystem/go_api_core/datatypes"
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// SoftDeleteField returns the field marking the deleted records of the model (see model.SoftDeleteModel), nil if it has none
+func SoftDeleteField(mdl any, modelSchema *schema.Schema) *schema.Field {
+	if softDeleteModel, ok := mdl.(model.SoftDeleteModel); ok {
+		return modelSchema.LookUpField(softDeleteModel.SoftDeleteField())
+	}
+	return nil
+}
+
+// isDeletionTime reports whether the field holds the time of the deletion instead of a flag
+func isDeletionTime(field *schema.Field) bool {
+	typ := field.FieldType
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.ConvertibleTo(timeType)
+}
+
+// DeletedValue returns the value of the field of the records deleted at the given time: the time itself or 1
+func DeletedValue(field *schema.Field, deletedAt time.Time) any {
+	if isDeletionTime(field) {
+		return datatypes.Datetime(deletedAt)
+	} else if field.DataType == schema.Bool {
+		return true
+	}
+	return 1
+}
+
+// RestoredValue returns the value of the field of the records that aren't deleted: NULL or 0
+func RestoredValue(field *schema.Field) any {
+	if isDeletionTime(field) {
+		return nil
+	} else if field.DataType == schema.Bool {
+		return false
+	}
+	return 0
+}
+
+// isDeleted reports whether the loaded model is marked as deleted
+func isDeleted(ctx context.Context, mdl any, modelSchema *schema.Schema) bool {
+	field := SoftDeleteField(mdl, modelSchema)
+	if field == nil {
+		return false
+	}
+	value, _ := field.ValueOf(ctx, reflect.Indirect(reflect.ValueOf(mdl)))
+	value = indirectValue(value)
+	return value != nil && !reflect.ValueOf(value).IsZero()
+}
+
+// NotDeletedCondition returns the condition excluding the deleted records of the table, empty if the model isn't soft deleted
+func NotDeletedCondition(d dialect.Dialect, mdl any, modelSchema *schema.Schema, table string) (string, []any) {
+	field := SoftDeleteField(mdl, modelSchema)
+	if field == nil {
+		return "", nil
+	}
+	column := table + "." + d.Quote(field.DBName)
+	if isDeletionTime(field) {
+		return column + " IS NULL", nil
+	}
+	return "(" + column + " IS NULL OR " + column + " = ?)", []any{RestoredValue(field)}
+}
+
+// CheckIncludeDeleted reports whether the request asks for the deleted records too, which requires model.PermissionsRestore
+func CheckIncludeDeleted(c *gin.Context, mdl any) (bool, message.Message) {
+	if c.Query("includeDeleted") != "1" {
+		return false, nil
+	}
+	if _, ok := mdl.(model.SoftDeleteModel); !ok {
+		return false, nil
+	}
+	return true, model.PermissionsRestore(mdl)(c)
+}
+
+/*
+RestoreFromDb restores the soft deleted models with their relations deleted in cascade, then replies with the
+restored records as the other write routes. The relations marked by a deletion time are restored when it's the one
+of the record, the ones marked by a flag are all restored since there's no way to tell when they were deleted.
+*/
+func RestoreFromDb(c *gin.Context, models []any) {
+	if c.IsAborted() || len(models) == 0 {
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	modelSchema, err := schema.Parse(models[0], &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+	field := SoftDeleteField(models[0], modelSchema)
+	if field == nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+	notDeleted, notDeletedArgs := NotDeletedCondition(dialect.For(db), models[0], modelSchema, modelSchema.Table)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, mdl := range models {
+			deleted := tx.Session(&gorm.Session{NewDB: true}).Model(mdl).Where("NOT "+notDeleted, notDeletedArgs...)
+			if condMdl, ok := mdl.(model.ConditionsModel); ok {
+				query, args := condMdl.DefaultConditions(db, modelSchema.Table)
+				if query != "" {
+					deleted = deleted.Where("("+query+")", args...)
+				}
+			}
+			if res := deleted.Session(&gorm.Session{}).Limit(1).Find(mdl); res.Error != nil {
+				return res.Error
+			} else if res.RowsAffected == 0 {
+				return message.ItemNotFound(c)
+			}
+			val := reflect.ValueOf(mdl)
+			deletedAt, _ := field.ValueOf(c, reflect.Indirect(val))
+			if err := restoreRelations(tx, val, modelSchema, indirectValue(deletedAt)); err != nil {
+				return err
+			}
+			if err := deleted.Update(field.DBName, RestoredValue(field)).Error; err != nil {
+				return err
+			}
+			if err := field.Set(c, reflect.Indirect(val), RestoredValue(field)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if len(models) == 1 {
+		WriteModelsResult(c, db, models[0])
+		return
+	}
+	restored := reflect.New(reflect.SliceOf(modelSchema.ModelType))
+	for _, mdl := range models {
+		restored.Elem().Set(reflect.Append(restored.Elem(), reflect.Indirect(reflect.ValueOf(mdl))))
+	}
+	WriteModelsResult(c, db, restored.Interface())
+}
+
+/*
+restoreRelations restores the soft deleted records of the relations of val deleted in cascade with it, the ones of
+the has one and has many relations (see the soft delete callbacks), recursively. deletedAt is the deletion time of
+the record, relations marked by a deletion time are restored only when it's the same.
+*/
+func restoreRelations(tx *gorm.DB, val reflect.Value, modelSchema *schema.Schema, deletedAt any) error {
+	relations := []*schema.Relationship{}
+	for _, rel := range modelSchema.Relationships.HasOne {
+		if fld := rel.References[0].ForeignKey; fld != nil && !fld.PrimaryKey {
+			relations = append(relations, rel)
+		}
+	}
+	relations = append(relations, modelSchema.Relationships.HasMany...)
+
+	d := dialect.For(tx)
+	for _, rel := range relations {
+		relMdl := reflect.New(rel.FieldSchema.ModelType).Interface()
+		field := SoftDeleteField(relMdl, rel.FieldSchema)
+		if field == nil || strings.HasPrefix(rel.FieldSchema.Table, "(") || !rel.Field.Updatable {
+			continue
+		}
+		deleted := tx.Session(&gorm.Session{NewDB: true}).Model(relMdl).Clauses(clause.Where{Exprs: rel.ToQueryConditions(tx.Statement.Context, reflect.Indirect(val))})
+		if isDeletionTime(field) && deletedAt != nil {
+			deleted = deleted.Where(rel.FieldSchema.Table+"."+d.Quote(field.DBName)+" = ?", deletedAt)
+		} else {
+			query, args := NotDeletedCondition(d, relMdl, rel.FieldSchema, rel.FieldSchema.Table)
+			deleted = deleted.Where("NOT "+query, args...)
+		}
+
+		records := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+		if err := deleted.Session(&gorm.Session{}).Find(records.Interface()).Error; err != nil {
+			return err
+		}
+		if records.Elem().Len() == 0 {
+			continue
+		}
+		for i := 0; i < records.Elem().Len(); i++ {
+			if err := restoreRelations(tx, records.Elem().Index(i), rel.FieldSchema, deletedAt); err != nil {
+				return err
+			}
+		}
+		if err := deleted.Update(field.DBName, RestoredValue(field)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Datosystem/go_api_core/datatypes"
+)
+
+type testArchived struct {
+	ID         int `gorm:"primaryKey"`
+	NAME       string
+	DELETED_AT *datatypes.Datetime
+	Items      []testArchivedItem `gorm:"foreignKey:ARCHIVED_ID"`
+	Notes      []testArchivedNote `gorm:"foreignKey:ARCHIVED_ID"`
+}
+
+func (testArchived) TableName() string {
+	return "ARCHIVED"
+}
+
+func (testArchived) SoftDeleteField() string {
+	return "DELETED_AT"
+}
+
+type testArchivedItem struct {
+	ID          int `gorm:"primaryKey"`
+	ARCHIVED_ID int
+	DELETED_AT  *datatypes.Datetime
+}
+
+func (testArchivedItem) TableName() string {
+	return "ARCHIVED_ITEMS"
+}
+
+func (testArchivedItem) SoftDeleteField() string {
+	return "DELETED_AT"
+}
+
+type testArchivedNote struct {
+	ID          int `gorm:"primaryKey"`
+	ARCHIVED_ID int
+	DELETED     bool
+}
+
+func (testArchivedNote) TableName() string {
+	return "ARCHIVED_NOTES"
+}
+
+func (testArchivedNote) SoftDeleteField() string {
+	return "DELETED"
+}
+
+// The relations deleted with the record are restored with it, the ones deleted before are kept
+func TestRestoreFromDb(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testArchived{}, &testArchivedItem{}, &testArchivedNote{}); err != nil {
+		t.Fatal(err)
+	}
+	deletedAt := datatypes.Datetime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	before := datatypes.Datetime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	record := testArchived{
+		ID: 1, NAME: "a", DELETED_AT: &deletedAt,
+		Items: []testArchivedItem{{ID: 1, DELETED_AT: &deletedAt}, {ID: 2, DELETED_AT: &before}, {ID: 3}},
+		Notes: []testArchivedNote{{ID: 1, DELETED: true}},
+	}
+	if err := db.Create(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := newTestContext(db, "/")
+	RestoreFromDb(c, []any{&testArchived{ID: 1}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	restored := testArchived{}
+	if err := json.Unmarshal(w.Body.Bytes(), &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.NAME != "a" || restored.DELETED_AT != nil {
+		t.Errorf("expected the restored record, got %s", w.Body.String())
+	}
+
+	items := []testArchivedItem{}
+	if err := db.Order("ID").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, deleted := range []bool{false, true, false} {
+		if (items[i].DELETED_AT != nil) != deleted {
+			t.Errorf("item %d: got deleted %v, want %v", items[i].ID, items[i].DELETED_AT != nil, deleted)
+		}
+	}
+	note := testArchivedNote{}
+	if err := db.Take(&note, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if note.DELETED {
+		t.Error("the note must be restored")
+	}
+
+	// The records that aren't deleted can't be restored
+	c, w = newTestContext(db, "/")
+	RestoreFromDb(c, []any{&testArchived{ID: 1}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want 404", w.Code)
+	}
+}
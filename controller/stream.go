@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/xlsx"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StreamErrorTrailer is the HTTP trailer with the error that interrupted a stream
+const StreamErrorTrailer = "X-Stream-Error"
+
+/*
+StreamQueryMapResult executes the query writing the rows to the response while they are read from the database,
+flushing the writer after every chunk. Only JSON and CSV are supported (see CanStream).
+Once the first chunk is written the status can't be changed anymore: a later error is reported in the
+StreamErrorTrailer trailer and, for JSON, by a last {"error": {...}} element, so that clients can tell a partial
+stream from a complete one.
+*/
+func StreamQueryMapResult(c *gin.Context, db *gorm.DB, args *QueryMapArgs, config QueryMapConfig) {
+	accept := c.GetHeader("Accept")
+	isCsv := accept == "application/csv" || accept == "text/csv"
+	var csvWriter *csv.Writer
+	var written int64
+
+	writeStart := func() {
+		c.Header("Trailer", StreamErrorTrailer)
+		if ShouldPaginate(args.PagStart, args.PagEnd) {
+			WritePaginationHeaders(c, args)
+		}
+		if isCsv {
+			c.Header("Content-Type", accept+"; charset=utf-8")
+			c.Header("Content-Disposition", "attachment; filename=data.csv")
+			c.Status(http.StatusOK)
+			csvWriter = csv.NewWriter(c.Writer)
+		} else {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			c.Writer.WriteString("[")
+		}
+	}
+
+	args.Stream = func(rows []map[string]any) error {
+		if written == 0 {
+			writeStart()
+			if isCsv {
+				if err := csvWriter.Write(CsvHeading(&args.Info)); err != nil {
+					return err
+				}
+			}
+		}
+		for _, row := range rows {
+			if isCsv {
+				if err := csvWriter.Write(CsvRow(c, &args.Info, row)); err != nil {
+					return err
+				}
+			} else {
+				LocalizeDatetimes(c, row)
+				data, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				if written > 0 {
+					c.Writer.WriteString(",")
+				}
+				if _, err := c.Writer.Write(data); err != nil {
+					return err
+				}
+			}
+			written++
+		}
+		if isCsv {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	err := QueryMap(c, db, args, config)
+	if written == 0 {
+		if AbortIfError(c, err) {
+			return
+		}
+		writeStart()
+	} else if err != nil {
+		log.Println(err)
+		msg, ok := err.(message.Message)
+		if !ok {
+			msg = message.InternalServerError(c)
+		}
+		if !isCsv {
+			data, _ := json.Marshal(gin.H{"error": msg.ToMap()})
+			c.Writer.WriteString(",")
+			c.Writer.Write(data)
+			c.Writer.WriteString("]")
+		}
+		c.Writer.Header().Set(StreamErrorTrailer, msg.Error())
+		c.Writer.Flush()
+		c.Abort()
+		return
+	}
+	if !isCsv {
+		c.Writer.WriteString("]")
+	}
+	c.Writer.Flush()
+}
+
+// CanStream reports whether the rows can be streamed in the format requested by the Accept header,
+// the other formats (XML, XLSX) are written by WriteQueryMapResult once all the rows are read
+func CanStream(accept string) bool {
+	switch accept {
+	case "application/xml", "text/xml", xlsx.ContentType:
+		return false
+	}
+	return true
+}
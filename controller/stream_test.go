@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// Every customer must be streamed once, with its orders, whether the orders are loaded on another connection or not
+func TestStreamNested(t *testing.T) {
+	tests := []struct {
+		name  string
+		dsn   string
+		conns int
+	}{
+		{"single connection", ":memory:", 1},
+		{"concurrent reads", "file:stream?mode=memory&cache=shared", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, tt.dsn, tt.conns)
+			if concurrent := concurrentReads(db); concurrent != (tt.conns > 1) {
+				t.Errorf("got concurrent reads %v", concurrent)
+			}
+			got := []int{}
+			orders := 0
+			chunks := 0
+			args := QueryMapArgs{Sel: "ID,NAME,>Orders.ID", Ord: "ID", Model: &testCustomer{}}
+			args.Stream = func(rows []map[string]any) error {
+				chunks++
+				got = append(got, ids(rows)...)
+				for _, row := range rows {
+					nested, _ := row["Orders"].([]map[string]any)
+					orders += len(nested)
+				}
+				return nil
+			}
+			c, _ := newTestContext(db, "/")
+			if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true, ChunkSize: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if want := []int{1, 2, 3}; !equalInts(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if chunks != 2 || orders != 3 {
+				t.Errorf("got %d chunks and %d orders, want 2 and 3", chunks, orders)
+			}
+		})
+	}
+}
+
+// testStrictName fails to scan the name "Beta"
+type testStrictName string
+
+func (n *testStrictName) Scan(value any) error {
+	if value == "Beta" {
+		return errors.New("invalid name")
+	}
+	*n = testStrictName(value.(string))
+	return nil
+}
+
+// testStrictCustomer can't be read past the first customer
+type testStrictCustomer struct {
+	ID   int `gorm:"primaryKey"`
+	NAME testStrictName
+}
+
+func (testStrictCustomer) TableName() string {
+	return "CUSTOMERS"
+}
+
+// An error after the first chunk must be reported at the end of the stream
+func TestStreamQueryMapResultError(t *testing.T) {
+	db := newTestDB(t)
+	c, w := newTestContext(db, "/")
+	args := QueryMapArgs{Sel: "ID,NAME", Ord: "ID", Model: &testStrictCustomer{}}
+	StreamQueryMapResult(c, db, &args, QueryMapConfig{SkipValidation: true, ChunkSize: 1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	rows := []map[string]any{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid JSON %s: %v", w.Body.String(), err)
+	}
+	if len(rows) != 2 || rows[1]["error"] == nil {
+		t.Errorf("expected an error as last element, got %s", w.Body.String())
+	}
+	if w.Result().Trailer.Get(StreamErrorTrailer) == "" {
+		t.Errorf("expected the %s trailer", StreamErrorTrailer)
+	}
+}
+
+// Unpaginated streams are bound by MaxRows
+func TestStreamMaxRows(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		maxRows int
+		rows    int
+		fails   bool
+	}{{3, 3, false}, {2, 0, true}}
+	for _, tt := range tests {
+		streamed := 0
+		args := QueryMapArgs{Sel: "ID,>Orders.ID", Ord: "ID", Model: &testCustomer{}}
+		args.Stream = func(rows []map[string]any) error {
+			streamed += len(rows)
+			return nil
+		}
+		c, _ := newTestContext(db, "/")
+		err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true, Limits: &QueryLimits{MaxRows: tt.maxRows}})
+		if (err != nil) != tt.fails {
+			t.Errorf("max rows %d: got error %v", tt.maxRows, err)
+		}
+		if streamed != tt.rows {
+			t.Errorf("max rows %d: got %d rows, want %d", tt.maxRows, streamed, tt.rows)
+		}
+	}
+}
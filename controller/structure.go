@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/Datosystem/go_api_core/model"
+	"github.com/Datosystem/go_api_core/params"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm/schema"
@@ -27,6 +28,9 @@ type FieldInfo struct {
 	Updatable       bool   `json:"updatable"`
 	Creatable       bool   `json:"creatable"`
 	Query           bool   `json:"query"`
+	Filterable      bool   `json:"filterable"`
+	Sortable        bool   `json:"sortable"`
+	Selectable      bool   `json:"selectable"`
 }
 
 type RelationInfo struct {
@@ -39,6 +43,9 @@ type RelationInfo struct {
 	Struct     *StructInfo `json:"struct"`
 	Updatable  bool        `json:"updatable"`
 	Creatable  bool        `json:"creatable"`
+	Filterable bool        `json:"filterable"`
+	Sortable   bool        `json:"sortable"`
+	Selectable bool        `json:"selectable"`
 }
 
 type StructInfo struct {
@@ -147,6 +154,9 @@ func GetFieldInfo(c *gin.Context, field *schema.Field) FieldInfo {
 		RequiredWith:    requiredWith,
 		Updatable:       field.Updatable,
 		Creatable:       field.Creatable,
+		Filterable:      params.AllowedPath(field.Schema, field.Name, params.FilterableFields),
+		Sortable:        params.AllowedPath(field.Schema, field.Name, model.SortableFields),
+		Selectable:      params.AllowedPath(field.Schema, field.Name, model.SelectableFields),
 	}
 
 	label := field.Tag.Get("label")
@@ -174,8 +184,11 @@ func GetFieldInfo(c *gin.Context, field *schema.Field) FieldInfo {
 func GetRelationInfo(c *gin.Context, rel *schema.Relationship, relations [][]string) RelationInfo {
 	gormTags := strings.Split(rel.Field.Tag.Get("gorm"), ";")
 	relationInfo := RelationInfo{
-		Field: rel.Field.Name,
-		Label: FieldToString(c, rel.Field),
+		Field:      rel.Field.Name,
+		Label:      FieldToString(c, rel.Field),
+		Filterable: params.AllowedPath(rel.Schema, rel.Name, params.FilterableFields),
+		Sortable:   params.AllowedPath(rel.Schema, rel.Name, model.SortableFields),
+		Selectable: params.AllowedPath(rel.Schema, rel.Name, model.SelectableFields),
 	}
 
 	typ := rel.Field.StructField.Type
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/datatypes"
+	"github.com/gin-gonic/gin"
+)
+
+var datetimeType = reflect.TypeOf(datatypes.Datetime{})
+
+// requestLocationOrUTC returns the time zone of the request used by the exports, UTC when it isn't set
+func requestLocationOrUTC(c *gin.Context) *time.Location {
+	if loc := app.RequestLocation(c); loc != nil {
+		return loc
+	}
+	return time.UTC
+}
+
+/*
+LocalizeDatetimes converts in place the datatypes.Datetime values of data (maps, slices, structs and pointers to them)
+to the time zone of the request, see app.RequestLocation. Nothing is changed when the request has no time zone.
+*/
+func LocalizeDatetimes(c *gin.Context, data any) {
+	if loc := app.RequestLocation(c); loc != nil {
+		localizeValue(reflect.ValueOf(data), loc)
+	}
+}
+
+func localizeValue(v reflect.Value, loc *time.Location) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			localizeValue(v.Elem(), loc)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			localizeValue(v.Index(i), loc)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			item := iter.Value()
+			if item.Kind() == reflect.Interface && !item.IsNil() && item.Elem().Type() == datetimeType {
+				// The values of the maps can't be set, they're replaced
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(item.Elem().Interface().(datatypes.Datetime).In(loc)))
+			} else {
+				localizeValue(item, loc)
+			}
+		}
+	case reflect.Struct:
+		if v.Type() == datetimeType {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(v.Interface().(datatypes.Datetime).In(loc)))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				localizeValue(v.Field(i), loc)
+			}
+		}
+	}
+}
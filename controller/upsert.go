@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+HandleUpsert creates or updates the records of the body, a single object or an array, in a single transaction.
+Records are updated when a record with the same updateKey fields (or primary keys if none is defined) exists,
+the path params, if any, identify the single record by its primary keys. The updates of versioned models (see
+model.VersionModel) require the version of the record in the $version field, or in the If-Match header for a single one,
+the conflicts of a single record reply with its current copy as WriteVersionConflict. The soft deleted records are
+reported as conflicts, they must be restored before being written.
+The updates require model.PermissionsPatch besides the model.PermissionsPost checked by the route.
+*/
+func HandleUpsert(c *gin.Context, db *gorm.DB, mdl any, primaryFields []string) {
+	if c.IsAborted() {
+		return
+	}
+
+	data, err := c.GetRawData()
+	data = bytes.TrimSpace(data)
+	if err != nil || len(data) == 0 {
+		message.InvalidJSON(c).Abort(c)
+		return
+	}
+
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+
+	single := data[0] != '['
+	if single {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(data, &rows); err != nil {
+		message.InvalidJSON(c).Text(err.Error()).Abort(c)
+		return
+	} else if single && rows[0] == nil {
+		message.InvalidJSON(c).Abort(c)
+		return
+	}
+	if version := ifMatchVersion(c); single && version != "" {
+		rows[0][versionBodyField] = version
+	}
+
+	keyFields := ImportKeyFields(modelSchema)
+	if len(c.Params) > 0 {
+		if !single {
+			message.InvalidJSON(c).Abort(c)
+			return
+		}
+		GetPathParams(c, reflect.New(modelSchema.ModelType).Interface(), primaryFields, &rows[0])
+		if c.IsAborted() {
+			return
+		}
+		keyFields = modelSchema.PrimaryFields
+	}
+
+	modelType := modelSchema.ModelType
+	newModel := func() any { return reflect.New(modelType).Interface() }
+	models := reflect.New(reflect.SliceOf(modelType))
+
+	var patchChecked bool
+	var conflicted any
+	err = db.Transaction(func(tx *gorm.DB) error {
+		checked := map[string]struct{}{}
+		for i, row := range rows {
+			written, _, err := upsertRow(c, tx, modelSchema, keyFields, newModel, row, checked, func() message.Message {
+				if !patchChecked {
+					patchChecked = true
+					return model.PermissionsPatch(newModel())(c)
+				}
+				return nil
+			})
+			if abort, ok := err.(importAbort); ok {
+				return abort.Message
+			}
+			if errors.Is(err, errVersionConflict) {
+				if single {
+					conflicted = written
+					return err
+				}
+				err = message.VersionConflict(c)
+			}
+			if msg, ok := err.(message.Message); ok && !single {
+				return msg.Set("row", i+1)
+			}
+			if err != nil {
+				return err
+			}
+			models.Elem().Set(reflect.Append(models.Elem(), reflect.ValueOf(written).Elem()))
+		}
+		return nil
+	})
+	if conflicted != nil {
+		WriteVersionConflict(c, db, conflicted)
+		return
+	}
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if single {
+		WriteModelsResult(c, db, models.Elem().Index(0).Addr().Interface())
+	} else {
+		WriteModelsResult(c, db, models.Interface())
+	}
+}
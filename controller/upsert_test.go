@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Datosystem/go_api_core/datatypes"
+)
+
+func TestHandleUpsertVersion(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testVersioned{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testVersioned{ID: 1, NAME: "a", VERSION: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		body    string
+		status  int
+		id      int
+		version int64
+		reply   string
+	}{
+		{"insert", "", `{"ID":2,"NAME":"b","VERSION":1}`, http.StatusOK, 2, 1, ""},
+		{"update without version", "", `{"ID":1,"NAME":"b"}`, http.StatusPreconditionRequired, 1, 7, ""},
+		{"update with $version", "", `{"ID":1,"NAME":"b","$version":7}`, http.StatusOK, 1, 8, ""},
+		// The conflict replies with the current copy of the record
+		{"update with stale $version", "", `{"ID":1,"NAME":"c","$version":7}`, http.StatusConflict, 1, 8, `"current":{"ID":1,"NAME":"b","VERSION":8}`},
+		{"update with If-Match", `"8"`, `{"ID":1,"NAME":"c"}`, http.StatusOK, 1, 9, ""},
+		{"array update", "", " \n[{\"ID\":1,\"NAME\":\"d\",\"$version\":9},{\"ID\":2,\"NAME\":\"e\",\"$version\":1}]", http.StatusOK, 2, 2, `"NAME":"e"`},
+		{"array conflict", "", `[{"ID":1,"NAME":"f","$version":9}]`, http.StatusConflict, 1, 10, `"row":1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newTestContext(db, "/")
+			c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+			HandleUpsert(c, db, &testVersioned{}, []string{"ID"})
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			stored := testVersioned{}
+			if err := db.Take(&stored, tt.id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.VERSION != tt.version {
+				t.Errorf("got version %d, want %d", stored.VERSION, tt.version)
+			}
+			if !strings.Contains(w.Body.String(), tt.reply) {
+				t.Errorf("got %s, want it to contain %s", w.Body.String(), tt.reply)
+			}
+		})
+	}
+}
+
+// The soft deleted records are neither updated nor inserted again
+func TestHandleUpsertDeleted(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testArchived{}); err != nil {
+		t.Fatal(err)
+	}
+	deletedAt := datatypes.Datetime(time.Now())
+	if err := db.Create(&testArchived{ID: 1, NAME: "a", DELETED_AT: &deletedAt}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := newTestContext(db, "/")
+	c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"ID":1,"NAME":"b"}`))
+	HandleUpsert(c, db, &testArchived{}, []string{"ID"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	stored := testArchived{}
+	if err := db.Take(&stored, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.NAME != "a" || stored.DELETED_AT == nil {
+		t.Errorf("the deleted record must not be written, got %+v", stored)
+	}
+}
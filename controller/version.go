@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// versionBodyField is the field of the body holding the version of the record, alternative to the If-Match header
+const versionBodyField = "$version"
+
+// errVersionConflict is returned by the updates matching no rows with the expected version
+var errVersionConflict = errors.New("version conflict")
+
+// VersionField returns the field of the version of the model (see model.VersionModel), nil if it has none
+func VersionField(mdl any, modelSchema *schema.Schema) *schema.Field {
+	if versionModel, ok := mdl.(model.VersionModel); ok {
+		return modelSchema.LookUpField(versionModel.VersionField())
+	}
+	return nil
+}
+
+// isRowVersion reports whether the version is a rowversion, updated by the database itself
+func isRowVersion(field *schema.Field) bool {
+	typ := field.FieldType
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
+
+/*
+RequestVersion returns the version of the record expected by the request, read from the If-Match header or from the
+$version field of the body. Rowversions are encoded in base64, as in the JSON of the records.
+*/
+func RequestVersion(c *gin.Context, field *schema.Field, jsonData []byte) (any, message.Message) {
+	if ifMatch := ifMatchVersion(c); ifMatch != "" {
+		return ParseVersion(c, field, ifMatch)
+	}
+	body := map[string]any{}
+	if json.Unmarshal(jsonData, &body) != nil || body[versionBodyField] == nil {
+		return nil, message.VersionRequired(c, field.Name)
+	}
+	return ParseVersion(c, field, body[versionBodyField])
+}
+
+// ifMatchVersion returns the version of the If-Match header without quotes, empty if it isn't set
+func ifMatchVersion(c *gin.Context) string {
+	return strings.Trim(strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/"), `"`)
+}
+
+// FormatVersion returns the version as sent by the clients (see ParseVersion), false when it's NULL
+func FormatVersion(version any) (string, bool) {
+	switch v := indirectValue(version).(type) {
+	case nil:
+		return "", false
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// ParseVersion converts the version sent by the client to the type of the version field
+func ParseVersion(c *gin.Context, field *schema.Field, value any) (any, message.Message) {
+	if isRowVersion(field) {
+		if s, ok := value.(string); ok {
+			if version, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return version, nil
+			}
+		}
+		return nil, message.InvalidParamType(c, versionBodyField, "base64")
+	}
+	switch v := value.(type) {
+	case string:
+		if version, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return version, nil
+		}
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	}
+	return nil, message.InvalidParamType(c, versionBodyField, "integer")
+}
+
+/*
+updateVersioned updates the model when its version is the expected one, incrementing the integer versions.
+It fails with errVersionConflict when no rows are updated. The version of the model is then read again.
+*/
+func updateVersioned(tx *gorm.DB, mdl any, values any, field *schema.Field, version any) error {
+	if field == nil {
+		return tx.Model(mdl).Updates(values).Error
+	}
+	if valuesMap, ok := values.(map[string]any); ok {
+		delete(valuesMap, field.Name)
+		delete(valuesMap, field.DBName)
+		if !isRowVersion(field) {
+			valuesMap[field.Name] = gorm.Expr("? + 1", clause.Column{Name: field.DBName})
+		}
+	}
+	res := tx.Model(mdl).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version}).Updates(values)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Select(field.DBName).Take(mdl).Error
+}
+
+// WriteVersionConflict aborts with message.VersionConflict, holding in current the record as it's stored now
+func WriteVersionConflict(c *gin.Context, db *gorm.DB, mdl any) {
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return
+	}
+	val := reflect.Indirect(reflect.ValueOf(mdl))
+	primaries := map[string]any{}
+	for _, field := range modelSchema.PrimaryFields {
+		primaries[field.DBName], _ = field.ValueOf(c, val)
+	}
+	args := QueryMapArgs{Sel: c.Query("sel"), Rel: c.Query("rel"), Primaries: primaries, Model: reflect.New(modelSchema.ModelType).Interface()}
+	if AbortIfError(c, QueryMap(c, db, &args, QueryMapConfig{})) {
+		return
+	}
+	LocalizeDatetimes(c, args.Result[0])
+	message.VersionConflict(c).Set("current", args.Result[0]).Abort(c)
+}
+
+// LoadVersion returns the version expected by the request when the model implements model.VersionModel, see RequestVersion
+func LoadVersion(c *gin.Context, mdl any, jsonData []byte) any {
+	if c.IsAborted() {
+		return nil
+	}
+	if _, ok := mdl.(model.VersionModel); !ok {
+		return nil
+	}
+	field := loadVersionField(c, mdl)
+	if field == nil {
+		return nil
+	}
+	version, msg := RequestVersion(c, field, jsonData)
+	if msg != nil {
+		msg.Abort(c)
+	}
+	return version
+}
+
+// LoadVersions returns the versions expected by the rows of the request, read from their $version fields
+func LoadVersions(c *gin.Context, models any, jsonData []byte) []any {
+	if c.IsAborted() {
+		return nil
+	}
+	mdl := reflect.New(reflect.Indirect(reflect.ValueOf(models)).Type().Elem()).Interface()
+	if _, ok := mdl.(model.VersionModel); !ok {
+		return nil
+	}
+	field := loadVersionField(c, mdl)
+	if field == nil {
+		return nil
+	}
+	rows := []map[string]any{}
+	if err := json.Unmarshal(jsonData, &rows); err != nil {
+		message.InvalidJSON(c).Abort(c)
+		return nil
+	}
+	versions := make([]any, len(rows))
+	for i, row := range rows {
+		var msg message.Message
+		if row[versionBodyField] == nil {
+			msg = message.VersionRequired(c, field.Name)
+		} else {
+			versions[i], msg = ParseVersion(c, field, row[versionBodyField])
+		}
+		if msg != nil {
+			msg.Text(message.RowError(c, i+1, " "+msg.Error()).Error()).Abort(c)
+			return nil
+		}
+	}
+	return versions
+}
+
+func loadVersionField(c *gin.Context, mdl any) *schema.Field {
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, c.MustGet("db").(*gorm.DB).NamingStrategy)
+	if err != nil {
+		message.InternalServerError(c).Abort(c)
+		return nil
+	}
+	field := VersionField(mdl, modelSchema)
+	if field == nil {
+		message.InternalServerError(c).Abort(c)
+	}
+	return field
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/schema"
+)
+
+type testVersioned struct {
+	ID      int `gorm:"primaryKey"`
+	NAME    string
+	VERSION int64
+}
+
+func (testVersioned) TableName() string {
+	return "VERSIONED"
+}
+
+func (testVersioned) VersionField() string {
+	return "VERSION"
+}
+
+func (testVersioned) PermissionsPatch(c *gin.Context) message.Message {
+	return nil
+}
+
+// The ETag of a single record must be accepted by If-Match
+func TestResultETagIfMatch(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testVersioned{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testVersioned{ID: 1, NAME: "a", VERSION: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		sel  string
+		etag string
+	}{
+		{"default select", "", `W/"7"`},
+		{"version selected", "ID,VERSION", `W/"7"`},
+		{"version not selected", "ID,NAME", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(db, "/")
+			args := QueryMapArgs{Sel: tt.sel, Primaries: map[string]any{"ID": 1}, Model: &testVersioned{}}
+			if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+				t.Fatal(err)
+			}
+			etag := ResultETag(c, &args)
+			if tt.etag == "" {
+				if etag == `W/"7"` {
+					t.Errorf("got the version as ETag without the version selected")
+				}
+				return
+			}
+			if etag != tt.etag {
+				t.Fatalf("got ETag %s, want %s", etag, tt.etag)
+			}
+
+			c.Request.Header.Set("If-Match", etag)
+			modelSchema, err := schema.Parse(&testVersioned{}, &sync.Map{}, db.NamingStrategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, msg := RequestVersion(c, VersionField(&testVersioned{}, modelSchema), nil)
+			if msg != nil {
+				t.Fatal(msg)
+			}
+			if version != int64(7) {
+				t.Errorf("got version %v, want 7", version)
+			}
+		})
+	}
+}
+
+// The weak ETag of a single record must match If-None-Match, with or without W/
+func TestWriteConditionalHeaders(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&testVersioned{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testVersioned{ID: 1, NAME: "a", VERSION: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		valid       bool
+	}{{`W/"7"`, true}, {`"7"`, true}, {`W/"6", W/"7"`, true}, {`W/"6"`, false}}
+	for _, tt := range tests {
+		c, w := newTestContext(db, "/")
+		c.Request.Header.Set("If-None-Match", tt.ifNoneMatch)
+		args := QueryMapArgs{Primaries: map[string]any{"ID": 1}, Model: &testVersioned{}}
+		if err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true}); err != nil {
+			t.Fatal(err)
+		}
+		if valid := WriteConditionalHeaders(c, &args); valid != tt.valid {
+			t.Errorf("%s: got %v, want %v", tt.ifNoneMatch, valid, tt.valid)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept, Timezone" {
+			t.Errorf("got Vary %q", vary)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ViewOwner returns the owner of the private views of the request, the USERNAME property of the session by default
+var ViewOwner = app.SessionUsername
+
+// ViewsController manages the saved views (app.View), its routes are protected by the VIEWS_* permissions
+type ViewsController struct {
+	Controller
+}
+
+func NewViewsController() *ViewsController {
+	return &ViewsController{Controller{Model: &app.View{}, Endpoint: "views"}}
+}
+
+// FindView returns the view of the model with the given name, the private view of the owner takes precedence over the shared one
+func FindView(c *gin.Context, db *gorm.DB, mdl any, name string) (*app.View, message.Message) {
+	modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return nil, message.InternalServerError(c)
+	}
+	owners := []string{""}
+	if owner := ViewOwner(c); owner != "" {
+		owners = append(owners, owner)
+	}
+	views := []app.View{}
+	if err := db.Session(&gorm.Session{NewDB: true}).Where(map[string]any{"CONTEXT": modelSchema.Table, "NAME": name, "OWNER": owners}).Find(&views).Error; err != nil {
+		return nil, message.InternalServerError(c)
+	}
+	var view *app.View
+	for i := range views {
+		if view == nil || views[i].OWNER != "" {
+			view = &views[i]
+		}
+	}
+	if view == nil {
+		return nil, message.ViewNotFound(c, name)
+	}
+	return view, nil
+}
+
+/*
+ApplyView merges the arguments of the view with the ones of the request: sel, rel, ord, group, q and the pagination
+of the request replace the ones of the view, while the params and p conditions are added to the ones of the view.
+*/
+func ApplyView(c *gin.Context, db *gorm.DB, name string, args *QueryMapArgs) message.Message {
+	view, msg := FindView(c, db, args.Model, name)
+	if msg != nil {
+		return msg
+	}
+	preset := QueryMapArgs{}
+	if len(view.QUERY_ARGS) > 0 && json.Unmarshal([]byte(view.QUERY_ARGS), &preset) != nil {
+		return message.InvalidJSON(c)
+	}
+
+	for _, arg := range []struct{ value, preset *string }{
+		{&args.Sel, &preset.Sel}, {&args.Rel, &preset.Rel}, {&args.Ord, &preset.Ord}, {&args.Group, &preset.Group},
+		{&args.Q, &preset.Q}, {&args.PagStart, &preset.PagStart}, {&args.PagEnd, &preset.PagEnd},
+	} {
+		if len(*arg.value) == 0 {
+			*arg.value = *arg.preset
+		}
+	}
+	args.Rank = args.Rank || preset.Rank
+
+	if len(preset.Params) > 0 {
+		if len(args.Params) > 0 {
+			// Each array is a group of conditions, so the ones of the request can't be joined with OR to the ones of the view
+			args.Params = "[" + preset.Params + "," + args.Params + "]"
+		} else {
+			args.Params = preset.Params
+		}
+	}
+	if len(preset.P) > 0 {
+		if len(args.P) > 0 {
+			p := strings.TrimSpace(args.P)
+			if !strings.HasPrefix(p, "{") {
+				return message.InvalidParamsJSON(c)
+			}
+			// The conditions of the request are nested, so that their logic operators don't affect the view ones
+			args.P = `{"__view":` + preset.P + `,"__request":` + p + `}`
+		} else {
+			args.P = preset.P
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testFilteredOrder can't be filtered by NOTE
+type testFilteredOrder struct {
+	ID     int `gorm:"primaryKey"`
+	AMOUNT float64
+	NOTE   *string
+}
+
+func (testFilteredOrder) TableName() string {
+	return "ORDERS"
+}
+
+func (testFilteredOrder) FilterableFields() []string {
+	return []string{"ID", "AMOUNT"}
+}
+
+// newViewsDB returns the test database with the views, the requests are made by owner1
+func newViewsDB(t *testing.T, views ...app.View) *gorm.DB {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&app.View{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(views) > 0 {
+		if err := db.Create(&views).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner := ViewOwner
+	t.Cleanup(func() { ViewOwner = owner })
+	ViewOwner = func(*gin.Context) string { return "owner1" }
+	return db
+}
+
+func TestFindView(t *testing.T) {
+	db := newViewsDB(t,
+		app.View{CONTEXT: "ORDERS", NAME: "open", QUERY_ARGS: `{"Sel":"ID"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "open", OWNER: "owner1", QUERY_ARGS: `{"Sel":"ID,NOTE"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "open", OWNER: "owner2", QUERY_ARGS: `{"Sel":"ID,AMOUNT"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "shared", QUERY_ARGS: `{"Sel":"AMOUNT"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "other", OWNER: "owner2"},
+		app.View{CONTEXT: "CUSTOMERS", NAME: "customers"},
+	)
+
+	tests := []struct {
+		name   string
+		args   string
+		status int
+	}{
+		// The private view takes precedence over the shared one
+		{"open", `{"Sel":"ID,NOTE"}`, 0},
+		{"shared", `{"Sel":"AMOUNT"}`, 0},
+		// The private views of the other owners and the views of the other models aren't visible
+		{"other", "", http.StatusNotFound},
+		{"customers", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(db, "/")
+			view, msg := FindView(c, db, &testOrder{}, tt.name)
+			if tt.status != 0 {
+				if msg == nil || msg.(*message.Msg).Status != tt.status {
+					t.Fatalf("got %v, want status %d", msg, tt.status)
+				}
+				return
+			}
+			if msg != nil {
+				t.Fatal(msg)
+			}
+			if view.QUERY_ARGS != tt.args {
+				t.Errorf("got %s, want %s", view.QUERY_ARGS, tt.args)
+			}
+		})
+	}
+}
+
+func TestApplyView(t *testing.T) {
+	db := newViewsDB(t,
+		app.View{CONTEXT: "ORDERS", NAME: "sorted", QUERY_ARGS: `{"Sel":"ID,NOTE","Ord":"AMOUNT DESC"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "large", QUERY_ARGS: `{"Sel":"ID","Ord":"ID","P":"{\"AMOUNT>\":15}"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "first", QUERY_ARGS: `{"Sel":"ID","Ord":"ID","Params":"[{\"CUSTOMER_ID\":1}]"}`},
+		app.View{CONTEXT: "ORDERS", NAME: "notes", QUERY_ARGS: `{"Sel":"ID","Ord":"ID","P":"{\"NOTE\":\"urgent\"}"}`},
+	)
+
+	tests := []struct {
+		name  string
+		view  string
+		args  QueryMapArgs
+		sel   string
+		ids   []int
+		model any
+		fails bool
+	}{
+		{"view arguments", "sorted", QueryMapArgs{}, "ID,NOTE", []int{4, 3, 2, 1}, nil, false},
+		// The sel and ord of the request replace the ones of the view
+		{"request arguments", "sorted", QueryMapArgs{Sel: "ID", Ord: "ID"}, "ID", []int{1, 2, 3, 4}, nil, false},
+		// The OR of the request can't undo the condition of the view
+		{"p", "large", QueryMapArgs{P: `{"AMOUNT<":15,"|NOTE":"urgent"}`}, "ID", []int{3}, nil, false},
+		{"params", "first", QueryMapArgs{Params: `[{"AMOUNT":20},"OR",{"AMOUNT":30}]`}, "ID", []int{2}, nil, false},
+		// The conditions of the view are checked as the ones of the request
+		{"field not filterable", "notes", QueryMapArgs{}, "ID", nil, &testFilteredOrder{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			args.Model = tt.model
+			if args.Model == nil {
+				args.Model = &testOrder{}
+			}
+			c, _ := newTestContext(db, "/")
+			if msg := ApplyView(c, db, tt.view, &args); msg != nil {
+				t.Fatal(msg)
+			}
+			if args.Sel != tt.sel {
+				t.Errorf("got sel %s, want %s", args.Sel, tt.sel)
+			}
+			err := QueryMap(c, db, &args, QueryMapConfig{SkipValidation: true})
+			if tt.fails {
+				if msg, ok := err.(*message.Msg); !ok || msg.Status != http.StatusUnprocessableEntity {
+					t.Errorf("got %v, want a 422 error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(args.Result); !equalInts(got, tt.ids) {
+				t.Errorf("got %v, want %v", got, tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/Datosystem/go_api_core/params"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	selectAlias = regexp.MustCompile(` AS (\[[^\]]+\]|"[^"]+"|\w+)$`)
+	rowNumAlias = "___RN___"
+	countSuffix = "Count"
+	// fieldAliasRegexp matches the valid names of the fields of the rows
+	fieldAliasRegexp = regexp.MustCompile(`^\w+$`)
+)
+
+// nestedWindow contains the options of a nested relation, see parseNestedWindow
+type nestedWindow struct {
+	Offset    int
+	Limit     int
+	Count     bool
+	CountName string
+}
+
+/*
+parseNestedWindow splits the name of a nested relation from its options, written between square brackets and
+separated by ";": the rows of each parent as in pagStart:pagEnd (eg. Lines[0:5], Lines[5] for the first 5 rows)
+and count, which adds to the parents the total number of rows of the relation (eg. LinesCount). The name of the
+count can be chosen with count=name (eg. Lines[count=TotalLines]).
+*/
+func parseNestedWindow(c *gin.Context, piece string) (name string, window *nestedWindow, msg message.Message) {
+	open := strings.Index(piece, "[")
+	if open == -1 {
+		return piece, nil, nil
+	}
+	if !strings.HasSuffix(piece, "]") {
+		return "", nil, message.InvalidRelation(c, piece)
+	}
+	window = &nestedWindow{}
+	for _, opt := range strings.Split(piece[open+1:len(piece)-1], ";") {
+		if opt == "count" {
+			window.Count = true
+			continue
+		}
+		if name, ok := strings.CutPrefix(opt, "count="); ok {
+			if !fieldAliasRegexp.MatchString(name) {
+				return "", nil, message.InvalidRelation(c, piece)
+			}
+			window.Count = true
+			window.CountName = name
+			continue
+		}
+		start, end, found := strings.Cut(opt, ":")
+		if !found {
+			start, end = "0", start
+		}
+		s, err := strconv.Atoi(start)
+		if err != nil || s < 0 {
+			return "", nil, message.InvalidRelation(c, piece)
+		}
+		e, err := strconv.Atoi(end)
+		if err != nil || e <= s {
+			return "", nil, message.InvalidRelation(c, piece)
+		}
+		window.Offset, window.Limit = s, e-s
+	}
+	return piece[:open], window, nil
+}
+
+// windowSelects returns the selected expressions numbering the rows of each parent, used with windowRows
+func windowSelects(d dialect.Dialect, info *ModelInfo) []string {
+	selects := make([]string, len(info.Select), len(info.Select)+1)
+	for i, sel := range info.Select {
+		if loc := selectAlias.FindStringIndex(sel); loc != nil {
+			sel = sel[:loc[0]]
+		}
+		// The columns of the subquery must have distinct names
+		selects[i] = sel + fmt.Sprintf(" AS ___C%d___", i)
+	}
+	order := info.Order
+	if len(order) == 0 {
+		if info.Schema.PrioritizedPrimaryField != nil {
+			order = info.Table + "." + d.Quote(info.Schema.PrioritizedPrimaryField.DBName)
+		} else {
+			order = "(SELECT NULL)"
+		}
+	}
+	return append(selects, "ROW_NUMBER() OVER (PARTITION BY "+info.ParentKey+" ORDER BY "+order+") AS "+rowNumAlias)
+}
+
+// windowRows wraps the query selecting windowSelects, keeping the rows of the window of each parent in their order
+func windowRows(tx *gorm.DB, info *ModelInfo) *gorm.DB {
+	delete(tx.Statement.Clauses, clause.OrderBy{}.Name())
+	fields := make([]string, len(info.Select))
+	for i := range fields {
+		fields[i] = fmt.Sprintf("T.___C%d___", i)
+	}
+	wtx := tx.Session(&gorm.Session{NewDB: true}).Table("(?) AS T", tx).Select(fields)
+	if info.Offset > 0 {
+		wtx = wtx.Where("T."+rowNumAlias+" > ?", info.Offset)
+	}
+	if info.Limit > 0 {
+		wtx = wtx.Where("T."+rowNumAlias+" <= ?", info.Offset+info.Limit)
+	}
+	return wtx.Order("T." + rowNumAlias)
+}
+
+// checkCountNames verifies that the counts of the nested relations don't overwrite the fields of their parents
+func checkCountNames(c *gin.Context, info *ModelInfo) message.Message {
+	for key, n := range info.Nested {
+		if n.ModelInfo.Count {
+			name := n.ModelInfo.CountName
+			_, nested := info.Nested[name]
+			if hasField(info, name) || info.Schema.LookUpField(name) != nil || nested {
+				return message.ConflictingCount(c, name, key)
+			}
+		}
+		if msg := checkCountNames(c, n.ModelInfo); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+// countModelInfo returns the model counting the rows of the nested relation for each parent
+func countModelInfo(info *ModelInfo) *ModelInfo {
+	return &ModelInfo{
+		Select:     []string{info.ParentKey + " AS " + fkAlias, "COUNT(1)"},
+		SelectArgs: []any{},
+		Fields:     []reflect.StructField{{Name: countSuffix, Type: reflect.TypeOf(int64(0))}},
+		Schema:     info.Schema,
+		Table:      info.Table,
+		Relations:  map[string]*params.Conditions{},
+		Nested:     map[string]NestedModel{},
+		Aggregate:  true,
+		GroupBy:    []string{info.ParentKey},
+	}
+}
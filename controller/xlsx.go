@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Datosystem/go_api_core/datatypes"
+	"github.com/Datosystem/go_api_core/xlsx"
+	"github.com/gin-gonic/gin"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// WriteXlsx writes the workbook as an attachment
+func WriteXlsx(c *gin.Context, wb *xlsx.Workbook) {
+	c.Header("Content-Type", xlsx.ContentType)
+	c.Header("Content-Disposition", "attachment; filename=data.xlsx")
+	c.Status(http.StatusOK)
+	if err := wb.Write(c.Writer); err != nil {
+		AbortWithError(c, err)
+	}
+}
+
+// QueryMapToXlsx converts the result of QueryMap to a workbook. Nested relations are written
+// in separate sheets, each row starting with the key of its parent row.
+func QueryMapToXlsx(c *gin.Context, info *ModelInfo, result []map[string]any) *xlsx.Workbook {
+	wb := xlsx.New()
+	sheet := wb.AddSheet("Data")
+	heading := xlsxHeading(info)
+	sheet.AddRow(heading...)
+	for _, item := range result {
+		sheet.AddRow(xlsxMapRow(c, info, item)...)
+	}
+	addNestedSheets(c, wb, "", info, result)
+	return wb
+}
+
+func addNestedSheets(c *gin.Context, wb *xlsx.Workbook, prefix string, info *ModelInfo, result []map[string]any) {
+	for _, key := range nestedKeys(info) {
+		rel := info.Nested[key]
+		name := key
+		if len(prefix) > 0 {
+			name = prefix + "." + key
+		}
+		resultKey := key
+		if index := strings.LastIndex(key, "."); index != -1 {
+			resultKey = key[index+1:]
+		}
+
+		sheet := wb.AddSheet(name)
+		heading := []any{}
+		for _, ref := range rel.References {
+			heading = append(heading, FieldLabel(ref.PrimaryKey.StructField))
+		}
+		heading = append(heading, xlsxHeading(rel.ModelInfo)...)
+		sheet.AddRow(heading...)
+
+		children := []map[string]any{}
+		for _, item := range result {
+			keys := []any{}
+			for _, ref := range rel.References {
+				keys = append(keys, xlsxValue(c, item[ref.PrimaryKey.Name]))
+			}
+			rows := []map[string]any{}
+			switch v := item[resultKey].(type) {
+			case []map[string]any:
+				rows = v
+			case map[string]any:
+				rows = append(rows, v)
+			}
+			for _, row := range rows {
+				sheet.AddRow(append(keys, xlsxMapRow(c, rel.ModelInfo, row)...)...)
+			}
+			children = append(children, rows...)
+		}
+		addNestedSheets(c, wb, name, rel.ModelInfo, children)
+	}
+}
+
+func xlsxMapRow(c *gin.Context, info *ModelInfo, item map[string]any) []any {
+	row := []any{}
+	for _, name := range outputFields(info) {
+		row = append(row, xlsxValue(c, item[name]))
+	}
+	return row
+}
+
+// xlsxHeading returns the labels of the outputFields, computed fields are labeled with their name
+func xlsxHeading(info *ModelInfo) []any {
+	heading := []any{}
+	for _, f := range info.Fields {
+		if _, hidden := info.Hidden[f.Name]; !hidden && f.Name != fkAlias {
+			heading = append(heading, FieldLabel(f))
+		}
+	}
+	for _, f := range info.Computed {
+		if _, hidden := info.Hidden[f.Name]; !hidden {
+			heading = append(heading, f.Name)
+		}
+	}
+	return heading
+}
+
+// DataToXlsx converts a struct or a slice of structs to a workbook. Slices of structs are written in separate sheets,
+// each row starting with the primary keys of its parent.
+func DataToXlsx(c *gin.Context, data any) *xlsx.Workbook {
+	wb := xlsx.New()
+	v := reflect.Indirect(reflect.ValueOf(data))
+	items := []reflect.Value{}
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i))
+		}
+	} else {
+		items = append(items, v)
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	addStructSheet(c, wb, "Data", t, items, nil, nil)
+	return wb
+}
+
+func addStructSheet(c *gin.Context, wb *xlsx.Workbook, name string, t reflect.Type, items []reflect.Value, keyFields []reflect.StructField, keys [][]any) {
+	columns := []reflect.StructField{}
+	slices := []reflect.StructField{}
+	for _, f := range reflect.VisibleFields(t) {
+		if f.Anonymous || !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+		typ := f.Type
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+			elem := typ.Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct {
+				slices = append(slices, f)
+			}
+		} else if typ.Kind() != reflect.Struct || typ.ConvertibleTo(timeType) {
+			columns = append(columns, f)
+		}
+	}
+
+	sheet := wb.AddSheet(name)
+	heading := []any{}
+	for _, f := range append(keyFields, columns...) {
+		heading = append(heading, FieldLabel(f))
+	}
+	sheet.AddRow(heading...)
+
+	primaryFields := []reflect.StructField{}
+	for _, p := range GetPrimaryFields(t) {
+		if f, ok := t.FieldByName(p); ok {
+			primaryFields = append(primaryFields, f)
+		}
+	}
+	itemKeys := make([][]any, len(items))
+	for i, item := range items {
+		item = reflect.Indirect(item)
+		row := []any{}
+		if keys != nil {
+			row = append(row, keys[i]...)
+		}
+		if !item.IsValid() {
+			continue
+		}
+		for _, f := range columns {
+			row = append(row, xlsxValue(c, item.FieldByIndex(f.Index).Interface()))
+		}
+		for _, f := range primaryFields {
+			itemKeys[i] = append(itemKeys[i], xlsxValue(c, item.FieldByIndex(f.Index).Interface()))
+		}
+		sheet.AddRow(row...)
+	}
+
+	for _, f := range slices {
+		children := []reflect.Value{}
+		childKeys := [][]any{}
+		for i, item := range items {
+			item = reflect.Indirect(item)
+			if !item.IsValid() {
+				continue
+			}
+			slice := reflect.Indirect(item.FieldByIndex(f.Index))
+			if !slice.IsValid() {
+				continue
+			}
+			for j := 0; j < slice.Len(); j++ {
+				children = append(children, slice.Index(j))
+				childKeys = append(childKeys, itemKeys[i])
+			}
+		}
+		elem := f.Type
+		for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice {
+			elem = elem.Elem()
+		}
+		addStructSheet(c, wb, name+"."+f.Name, elem, children, primaryFields, childKeys)
+	}
+}
+
+// xlsxValue converts the value to a type handled by the xlsx package
+func xlsxValue(c *gin.Context, val any) any {
+	v := reflect.ValueOf(val)
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	switch t := v.Interface().(type) {
+	case datatypes.Date:
+		return xlsx.Date(t)
+	case datatypes.Datetime:
+		if c.GetHeader("Only-Date") != "" {
+			return xlsx.Date(t)
+		}
+		return time.Time(t).In(requestLocationOrUTC(c))
+	case time.Time:
+		return t
+	}
+	if v.Type().ConvertibleTo(timeType) {
+		return v.Convert(timeType).Interface()
+	}
+	return v.Interface()
+}
+
+// FieldLabel returns the label tag of the field or its name in sentence case
+func FieldLabel(field reflect.StructField) string {
+	if label := field.Tag.Get("label"); label != "" {
+		return label
+	}
+	return SentenceCase(strings.ReplaceAll(field.Name, "_", " "))
+}
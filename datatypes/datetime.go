@@ -6,13 +6,21 @@ import (
 	"time"
 )
 
+// StorageLocation is the time zone of the datetimes stored in the database, nil keeps the location of the driver
+var StorageLocation *time.Location
+
 type Datetime time.Time
 
 func (date *Datetime) Scan(value interface{}) (err error) {
 	nullTime := &sql.NullTime{}
 	err = nullTime.Scan(value)
 	if err == nil {
-		*date = Datetime(nullTime.Time)
+		t := nullTime.Time
+		if StorageLocation != nil && !t.IsZero() {
+			// The database has no time zone, the wall clock is in the storage one
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), StorageLocation)
+		}
+		*date = Datetime(t)
 	} else if s, ok := value.(string); ok {
 		t, _ := time.Parse(time.RFC3339, s)
 		*date = Datetime(t)
@@ -22,9 +30,20 @@ func (date *Datetime) Scan(value interface{}) (err error) {
 
 func (date Datetime) Value() (driver.Value, error) {
 	t := time.Time(date)
+	if StorageLocation != nil && !t.IsZero() {
+		t = t.In(StorageLocation)
+	}
 	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location()), nil
 }
 
+// In returns the datetime in the given location, the datetime itself when loc is nil
+func (date Datetime) In(loc *time.Location) Datetime {
+	if loc == nil || time.Time(date).IsZero() {
+		return date
+	}
+	return Datetime(time.Time(date).In(loc))
+}
+
 // GormDataType gorm common data type
 func (date Datetime) GormDataType() string {
 	return "datetime"
@@ -0,0 +1,191 @@
+package dialect
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dialect contains the database specific pieces of the generated queries
+type Dialect interface {
+	// Quote quotes an identifier (column or alias)
+	Quote(name string) string
+	// Concat returns the expression concatenating the string expressions
+	Concat(exprs ...string) string
+	// CastText returns the expression converting expr to an unbounded string
+	CastText(expr string) string
+	// Length returns the expression computing the length of the string expression
+	Length(expr string) string
+	// NullsFirst reports whether the NULL values are sorted before the others in ascending order
+	NullsFirst() bool
+	// LockRows makes the query on the table lock the rows it reads against concurrent writes until the end of the transaction
+	LockRows(tx *gorm.DB, table string) *gorm.DB
+	// IsConflict reports whether the error is caused by the submitted data (unique violations, failed conversions)
+	IsConflict(err error) bool
+}
+
+var dialects = map[string]Dialect{
+	"sqlserver": SQLServer{},
+	"postgres":  Postgres{},
+	"sqlite":    SQLite{},
+}
+
+// Register adds or replaces the dialect used for the gorm dialector with the given name
+func Register(name string, d Dialect) {
+	dialects[name] = d
+}
+
+// For returns the dialect of the database, SQL Server is used when the dialector is unknown
+func For(db *gorm.DB) Dialect {
+	if db != nil && db.Dialector != nil {
+		if d, ok := dialects[db.Dialector.Name()]; ok {
+			return d
+		}
+	}
+	return SQLServer{}
+}
+
+// IsConflict reports whether the error, of any of the registered dialects, is caused by the submitted data
+func IsConflict(err error) bool {
+	for _, d := range dialects {
+		if d.IsConflict(err) {
+			return true
+		}
+	}
+	return false
+}
+
+type MSSqlError interface {
+	Error() string
+	SQLErrorClass() uint8
+	SQLErrorLineNo() int32
+	SQLErrorMessage() string
+	SQLErrorNumber() int32
+	SQLErrorProcName() string
+	SQLErrorServerName() string
+	SQLErrorState() uint8
+}
+
+type SQLServer struct{}
+
+func (SQLServer) Quote(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (SQLServer) Concat(exprs ...string) string {
+	return strings.Join(exprs, " + ")
+}
+
+func (SQLServer) CastText(expr string) string {
+	return "CAST(" + expr + " AS NVARCHAR(MAX))"
+}
+
+func (SQLServer) Length(expr string) string {
+	return "LEN(" + expr + ")"
+}
+
+func (SQLServer) NullsFirst() bool {
+	return true
+}
+
+func (d SQLServer) LockRows(tx *gorm.DB, table string) *gorm.DB {
+	// HOLDLOCK keeps the range locked when no row matches, so concurrent inserts of the same keys wait too
+	tx = tx.Table(d.Quote(table) + " WITH (UPDLOCK, HOLDLOCK)")
+	tx.Statement.Table = table
+	return tx
+}
+
+func (SQLServer) IsConflict(err error) bool {
+	var mssqlerr MSSqlError
+	if errors.As(err, &mssqlerr) {
+		switch mssqlerr.SQLErrorNumber() {
+		case 242, /* Invalid nvarchar conversion range */
+			245,  /* Cast failed */
+			2601, /* Unique constraint violation */
+			8114 /* Errore durante la conversione del tipo di dati da nvarchar a float. */ :
+			return true
+		}
+	}
+	return false
+}
+
+// PgError is implemented by the errors of the pgx driver
+type PgError interface {
+	Error() string
+	SQLState() string
+}
+
+type Postgres struct{}
+
+func (Postgres) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (Postgres) Concat(exprs ...string) string {
+	return strings.Join(exprs, " || ")
+}
+
+func (Postgres) CastText(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+func (Postgres) Length(expr string) string {
+	return "LENGTH(" + expr + ")"
+}
+
+func (Postgres) NullsFirst() bool {
+	return false
+}
+
+func (Postgres) LockRows(tx *gorm.DB, table string) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+func (Postgres) IsConflict(err error) bool {
+	var pgerr PgError
+	if errors.As(err, &pgerr) {
+		switch pgerr.SQLState() {
+		case "22003", /* Numeric value out of range */
+			"22007", /* Invalid datetime format */
+			"22008", /* Datetime field overflow */
+			"22P02", /* Invalid text representation */
+			"23505" /* Unique constraint violation */ :
+			return true
+		}
+	}
+	return false
+}
+
+type SQLite struct{}
+
+func (SQLite) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (SQLite) Concat(exprs ...string) string {
+	return strings.Join(exprs, " || ")
+}
+
+func (SQLite) CastText(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+func (SQLite) Length(expr string) string {
+	return "LENGTH(" + expr + ")"
+}
+
+func (SQLite) NullsFirst() bool {
+	return true
+}
+
+func (SQLite) LockRows(tx *gorm.DB, table string) *gorm.DB {
+	// The writes lock the whole database, the rows can't be locked
+	return tx
+}
+
+func (SQLite) IsConflict(err error) bool {
+	// SQLite columns aren't strictly typed, so only unique violations are reported by the drivers
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
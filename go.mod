@@ -12,6 +12,7 @@ require (
 	github.com/phpdave11/gofpdf v1.4.2
 	golang.org/x/net v0.15.0
 	golang.org/x/text v0.13.0
+	gorm.io/driver/sqlite v1.4.4
 	gorm.io/gorm v1.25.7
 )
 
@@ -29,6 +30,7 @@ require (
 	github.com/klauspost/cpuid/v2 v2.2.4 // indirect
 	github.com/leodido/go-urn v1.2.4 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/mattn/go-sqlite3 v1.14.17 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pelletier/go-toml/v2 v2.1.0 // indirect
@@ -88,6 +88,13 @@ func FolderNotFound(c *gin.Context) Message {
 	}
 }
 
+func ViewNotFound(c *gin.Context, name string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The view %s doesn't exist", name),
+		Status:  http.StatusNotFound,
+	}
+}
+
 // 409
 func Conflict(c *gin.Context) Message {
 	return &Msg{
@@ -125,6 +132,20 @@ func ConflictingPaginationAndAggregation(c *gin.Context) Message {
 	}
 }
 
+func ConflictingPaginationAndCursor(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The 'after' cursor cannot be combined with the 'pagStart' offset"),
+		Status:  http.StatusConflict,
+	}
+}
+
+func ConflictingStreamAndCursor(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("Streamed responses don't support cursor pagination"),
+		Status:  http.StatusConflict,
+	}
+}
+
 func ConflictingOrderByAndDistinct(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("The Order field must be specified in the Select field when using Distinct"),
@@ -153,6 +174,41 @@ func MissingRequiredParameter(c *gin.Context, name, in string) Message {
 	}
 }
 
+func VersionConflict(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The record has been modified by another user, reload it and try again"),
+		Status:  http.StatusConflict,
+	}
+}
+
+func RecordDeleted(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The record has been deleted, restore it before writing it"),
+		Status:  http.StatusConflict,
+	}
+}
+
+func PatchTestFailed(c *gin.Context, path string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The test operation on %s failed", path),
+		Status:  http.StatusConflict,
+	}
+}
+
+func RelationItemsNotRemovable(c *gin.Context, relation string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The items of the relation %s can't be removed", relation),
+		Status:  http.StatusConflict,
+	}
+}
+
+func BulkCountMismatch(c *gin.Context, confirmed, count int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The filter matches %d records instead of the %d confirmed", count, confirmed),
+		Status:  http.StatusConflict,
+	}
+}
+
 func MissingForeignKey(c *gin.Context, key, rel string) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Could not find the foreign key %s, required by the relation %s, in its parent object.", key, rel),
@@ -160,6 +216,14 @@ func MissingForeignKey(c *gin.Context, key, rel string) Message {
 	}
 }
 
+// 415
+func UnsupportedMediaType(c *gin.Context, contentType string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The content type %s is not supported", contentType),
+		Status:  http.StatusUnsupportedMediaType,
+	}
+}
+
 // 422
 func Unprocessable(c *gin.Context) Message {
 	return &Msg{
@@ -175,6 +239,13 @@ func InvalidJSON(c *gin.Context) Message {
 	}
 }
 
+func InvalidCSV(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("Missing or invalid CSV body"),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
 func InvalidParamsJSON(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("The supplied params JSON isn't syntactically valid"),
@@ -245,6 +316,62 @@ func InvalidOrders(c *gin.Context, orders ...string) Message {
 	}
 }
 
+func InvalidCursor(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The supplied cursor is invalid or doesn't match the requested order"),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func UnsupportedCursorOrder(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The order field %s must be a selected column to be used with cursor pagination", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func FieldNotFilterable(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The field %s can't be used to filter this resource", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func FieldNotSortable(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The field %s can't be used to order this resource", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func FieldNotSelectable(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The field %s can't be selected from this resource", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func ConflictingCount(c *gin.Context, name, relation string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The count %s of the relation %s conflicts with a field, choose another name (eg. %s[count=name])", name, relation, relation),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func UngroupedField(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The selected field %s must be aggregated or included in the group by", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func AggregateOutsideHaving(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The condition on the aggregate %s must be specified in $having", field),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
 func DuplicateStructField(c *gin.Context, field string) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Duplicate struct field %s, use an alias to avoid this error (eg. field AS alias)", field),
@@ -273,6 +400,70 @@ func DisplayNameNotSupported(c *gin.Context) Message {
 	}
 }
 
+func SearchNotSupported(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("This resource doesn't support the search"),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func InvalidPatchOperation(c *gin.Context, operation string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The patch operation %s is not valid", operation),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func InvalidPatchPath(c *gin.Context, path string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The path %s of the patch can't be applied to the record", path),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func PageSizeTooLarge(c *gin.Context, max int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The requested page exceeds the maximum size of %d rows", max),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func TooManyRows(c *gin.Context, max int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The query returns more than %d rows, use the pagination", max),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func NestingTooDeep(c *gin.Context, max int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The nested relations exceed the maximum depth of %d", max),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func TooManyRelations(c *gin.Context, max int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The query joins more than %d relations", max),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func TooManyConditions(c *gin.Context, max int) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The params contain more than %d conditions", max),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+// 428
+func VersionRequired(c *gin.Context, field string) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The version %s of the record is required, send it in the If-Match header or in the $version field", field),
+		Status:  http.StatusPreconditionRequired,
+	}
+}
+
 // 5** - Server error
 
 func InternalServerError(c *gin.Context) Message {
@@ -296,6 +487,22 @@ func UnsupportedParamType(c *gin.Context, parameter string) Message {
 	}
 }
 
+// 501
+func AuditNotEnabled(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The audit trail isn't enabled"),
+		Status:  http.StatusNotImplemented,
+	}
+}
+
+// 504
+func QueryTimeout(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("The query exceeded the time limit"),
+		Status:  http.StatusGatewayTimeout,
+	}
+}
+
 // System messages
 
 type SkipDelete struct{}
@@ -4,6 +4,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/Datosystem/go_api_core/params"
 	"github.com/gin-gonic/gin"
@@ -39,6 +40,64 @@ type OrderedModel interface {
 	DefaultOrder(*gorm.DB, string) string
 }
 
+// FilterableModel limits the fields usable in params and p, a relation must be listed to filter on its fields
+// which are checked against the whitelist of the related model
+type FilterableModel interface {
+	FilterableFields() []string
+}
+
+// SortableModel limits the fields usable in ord, relations are checked as in FilterableModel
+type SortableModel interface {
+	SortableFields() []string
+}
+
+// SelectableModel limits the fields usable in sel and rel, the other fields are excluded from the * selections
+type SelectableModel interface {
+	SelectableFields() []string
+}
+
+// SortableFields returns the whitelist of SortableModel, nil if the model doesn't implement it
+func SortableFields(model any) []string {
+	if m, ok := model.(SortableModel); ok {
+		return m.SortableFields()
+	}
+	return nil
+}
+
+// SelectableFields returns the whitelist of SelectableModel, nil if the model doesn't implement it
+func SelectableFields(model any) []string {
+	if m, ok := model.(SelectableModel); ok {
+		return m.SelectableFields()
+	}
+	return nil
+}
+
+/*
+VersionModel exposes the field holding the version of the record, an integer incremented by every update or a rowversion
+([]byte), used to compute the ETag and for the optimistic concurrency of Patch and PatchMany.
+*/
+type VersionModel interface {
+	VersionField() string
+}
+
+// LastModifiedModel exposes the field holding the time of the last update of the record, used for If-Modified-Since
+type LastModifiedModel interface {
+	LastModifiedField() string
+}
+
+/*
+SoftDeleteModel marks the deleted records through a field instead of deleting them: a bool or integer flag, or a
+nullable datetime holding the time of the deletion. The deleted records are hidden unless includeDeleted=1 is requested.
+*/
+type SoftDeleteModel interface {
+	SoftDeleteField() string
+}
+
+// SkipAuditModel excludes the writes of the model from the audit trail when SkipAudit returns true
+type SkipAuditModel interface {
+	SkipAudit() bool
+}
+
 type ValidationModel interface {
 	Validate(*gin.Context) message.Message
 }
@@ -66,9 +125,10 @@ type BaseModel struct {
 }
 
 func (BaseModel) QueryDISPLAY_NAME(c *gin.Context, model interface{}, modelSchema *schema.Schema, table string, nested bool, query *string, args *[]any, rels map[string]*params.Conditions) message.Message {
+	d := dialect.For(c.MustGet("db").(*gorm.DB))
 	if m, ok := model.(DisplayNamePatternModel); ok {
 		pattern := m.DisplayNamePattern()
-		sel, relSet := DisplayPatternToSql(pattern, modelSchema, table, nested)
+		sel, relSet := DisplayPatternToSql(d, pattern, modelSchema, table, nested)
 		for rel := range relSet {
 			rels[rel] = &params.Conditions{}
 		}
@@ -127,49 +187,43 @@ func (BaseModel) QueryDISPLAY_NAME(c *gin.Context, model interface{}, modelSchem
 			return message.DisplayNameNotSupported(c)
 		}
 
-		var sel string
-		if len(fields) > 0 {
-			t := fields[0].Table
-			for i := range fields {
-				if fields[i].Table != t {
-					sel += "+ ' - ' +"
-				}
-				sel += DisplayFieldToSql(fields[i].Table, fields[i].Field, i > 0)
+		parts := []string{}
+		t := fields[0].Table
+		for i := range fields {
+			if fields[i].Table != t {
+				parts = append(parts, "' - '")
 			}
+			parts = append(parts, DisplayFieldToSql(d, fields[i].Table, fields[i].Field, i > 0))
 		}
-		*query = "LTRIM(RTRIM(" + sel + "))"
+		*query = "LTRIM(RTRIM(" + d.Concat(parts...) + "))"
 		return nil
 	}
 }
 
-func DisplayFieldToSql(table string, field *schema.Field, concat bool) string {
-	sel := "CASE WHEN " + table + "." + field.DBName + " IS NOT NULL"
+// DisplayFieldToSql returns the expression converting the field to a string, empty when null.
+// With concat the value is prefixed by a space, to be concatenated to the previous fields
+func DisplayFieldToSql(d dialect.Dialect, table string, field *schema.Field, concat bool) string {
+	column := table + "." + d.Quote(field.DBName)
+	sel := "CASE WHEN " + column + " IS NOT NULL"
 	if field.DataType == schema.String {
-		sel += " AND LEN(" + table + "." + field.DBName + ") > 0"
+		sel += " AND " + d.Length(column) + " > 0"
+	} else {
+		column = d.CastText(column)
 	}
-	sel += " THEN"
 	if concat {
-		sel = " + " + sel + " ' ' + "
-	}
-	if field.DataType == schema.String {
-		sel += table + "." + field.DBName
-	} else {
-		sel += " CAST(" + table + "." + field.DBName + " AS NVARCHAR(MAX))"
+		column = d.Concat("' '", column)
 	}
-	return sel + " ELSE '' END"
+	return sel + " THEN " + column + " ELSE '' END"
 }
 
-func DisplayPatternToSql(pattern string, modelSchema *schema.Schema, table string, nested bool) (string, map[string]*params.Conditions) {
+func DisplayPatternToSql(d dialect.Dialect, pattern string, modelSchema *schema.Schema, table string, nested bool) (string, map[string]*params.Conditions) {
 	var startIndex int
-	var sel string
+	parts := []string{}
 	relSet := map[string]*params.Conditions{}
 	for i, char := range pattern {
 		if string(char) == "{" {
 			if i-startIndex > 0 {
-				if len(sel) > 0 {
-					sel += "+"
-				}
-				sel += "'" + pattern[startIndex:i] + "'"
+				parts = append(parts, "'"+pattern[startIndex:i]+"'")
 			}
 			startIndex = i + 1
 		} else if string(char) == "}" {
@@ -193,18 +247,12 @@ func DisplayPatternToSql(pattern string, modelSchema *schema.Schema, table strin
 					t = strings.ReplaceAll(rel, ".", "__")
 				}
 			}
-			if len(sel) > 0 {
-				sel += "+"
-			}
-			sel += DisplayFieldToSql(t, relSchema.LookUpField(pieces[len(pieces)-1]), false)
+			parts = append(parts, DisplayFieldToSql(d, t, relSchema.LookUpField(pieces[len(pieces)-1]), false))
 			startIndex = i + 1
 		}
 	}
 	if len(pattern)-startIndex > 0 {
-		if len(sel) > 0 {
-			sel += "+"
-		}
-		sel += "'" + pattern[startIndex:] + "'"
+		parts = append(parts, "'"+pattern[startIndex:]+"'")
 	}
-	return sel, relSet
+	return d.Concat(parts...), relSet
 }
@@ -32,6 +32,14 @@ type ModelWithPermissionsDelete interface {
 	PermissionsDelete(c *gin.Context) message.Message
 }
 
+type ModelWithPermissionsRestore interface {
+	PermissionsRestore(c *gin.Context) message.Message
+}
+
+type ModelWithPermissionsHistory interface {
+	PermissionsHistory(c *gin.Context) message.Message
+}
+
 func PermissionsPrefix(model interface{}) string {
 	var prefix string
 	if prefixModel, ok := model.(ModelWithPermissionsPrefix); ok {
@@ -91,3 +99,25 @@ func PermissionsDelete(model interface{}) PermissionFunc {
 		}
 	}
 }
+
+// PermissionsRestore is required to restore the soft deleted records and to read them with includeDeleted=1
+func PermissionsRestore(model interface{}) PermissionFunc {
+	if modelPerm, ok := model.(ModelWithPermissionsRestore); ok {
+		return modelPerm.PermissionsRestore
+	} else {
+		return func(c *gin.Context) message.Message {
+			return c.MustGet("s").(*app.Session).CheckOne(c, PermissionsPrefix(model)+"_RESTORE")
+		}
+	}
+}
+
+// PermissionsHistory is required to read the audit trail of the records
+func PermissionsHistory(model interface{}) PermissionFunc {
+	if modelPerm, ok := model.(ModelWithPermissionsHistory); ok {
+		return modelPerm.PermissionsHistory
+	} else {
+		return func(c *gin.Context) message.Message {
+			return c.MustGet("s").(*app.Session).CheckOne(c, PermissionsPrefix(model)+"_HISTORY")
+		}
+	}
+}
@@ -2,7 +2,11 @@ package params
 
 import (
 	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/gin-gonic/gin"
 	"github.com/iancoleman/orderedmap"
@@ -14,24 +18,28 @@ type NextNesterer[NestedType any] interface {
 }
 
 type Conditions struct {
-	// Types: N nested, I inner join, O outer join, 0 join, M mixed - nested and join
+	// Types: N nested, I inner join, O outer join, 0 join, M mixed - nested and join, H having
 	Type   string
 	Query  string
 	Args   []interface{}
 	Nested map[string]*Conditions
+	// Conditions on the aggregated values, specified with the "$having" key of the params v2
+	Having *Conditions
+	// Relevance of the rows for the search (see Search), the results are ordered by it when set
+	Rank *Conditions
 }
 
 func (c *Conditions) NextNested() map[string]*Conditions {
 	return c.Nested
 }
 
-func ToStmt(c *gin.Context, params, p string, modelSchema *schema.Schema, alias string, conds *Conditions, allowed map[string]struct{}) message.Message {
+func ToStmt(c *gin.Context, d dialect.Dialect, params, p string, modelSchema *schema.Schema, alias string, conds *Conditions, allowed map[string]struct{}) message.Message {
 	if len(params) > 0 {
 		var paramsArr []interface{}
 		if json.Unmarshal([]byte(params), &paramsArr) != nil {
 			return message.InvalidParamsJSON(c)
 		}
-		if msg := parseParams(c, modelSchema, alias, paramsArr, conds, allowed); msg != nil {
+		if msg := parseParams(c, d, modelSchema, alias, paramsArr, conds, allowed); msg != nil {
 			return msg
 		}
 	}
@@ -52,9 +60,112 @@ func ToStmt(c *gin.Context, params, p string, modelSchema *schema.Schema, alias
 	}*/
 
 	if len(pMap.Keys()) > 0 {
-		if msg := parseParamsV2(c, modelSchema, alias, pMap, conds, allowed); msg != nil {
+		if msg := parseParamsV2(c, d, modelSchema, alias, pMap, conds, allowed); msg != nil {
 			return msg
 		}
 	}
 	return nil
 }
+
+// CountDistinct is the aggregate function of COUNT(DISTINCT field)
+const CountDistinct = "COUNT DISTINCT"
+
+var aggregates = []string{"SUM", "AVG", "MIN", "MAX", "COUNT"}
+
+// ParseAggregate splits an aggregate expression (eg. "SUM(AMOUNT)", "COUNT(DISTINCT ID)") in function and field
+func ParseAggregate(field string) (fn, inner string, ok bool) {
+	for _, name := range aggregates {
+		if strings.HasPrefix(field, name+"(") && strings.HasSuffix(field, ")") {
+			inner = strings.TrimSpace(field[len(name)+1 : len(field)-1])
+			if name == "COUNT" && strings.HasPrefix(inner, "DISTINCT ") {
+				return CountDistinct, strings.TrimSpace(inner[9:]), true
+			}
+			return name, inner, true
+		}
+	}
+	return "", "", false
+}
+
+// AggregateToSql applies the aggregate function returned by ParseAggregate to the expression
+func AggregateToSql(fn, expr string) string {
+	if fn == CountDistinct {
+		return "COUNT(DISTINCT " + expr + ")"
+	}
+	return fn + "(" + expr + ")"
+}
+
+// AllowedPath reports whether every piece of the dotted path is in the whitelist returned by fields for the model
+// of that piece (eg. Customer.NAME needs Customer in the model whitelist and NAME in the Customer one).
+// Models without a whitelist (nil) allow all their fields.
+func AllowedPath(modelSchema *schema.Schema, path string, fields func(mdl any) []string) bool {
+	pieces := strings.Split(path, ".")
+	for i, piece := range pieces {
+		piece = strings.TrimPrefix(piece, ">")
+		if list := fields(reflect.New(modelSchema.ModelType).Interface()); list != nil && !slices.Contains(list, piece) {
+			return false
+		}
+		if i < len(pieces)-1 {
+			rel, ok := modelSchema.Relationships.Relations[piece]
+			if !ok {
+				// Invalid relations are reported while parsing
+				return true
+			}
+			modelSchema = rel.FieldSchema
+		}
+	}
+	return true
+}
+
+// FilterableFields returns the whitelist of model.FilterableModel, nil if the model doesn't implement it
+func FilterableFields(mdl any) []string {
+	if m, ok := mdl.(interface{ FilterableFields() []string }); ok {
+		return m.FilterableFields()
+	}
+	return nil
+}
+
+// CountConditions returns the number of conditions contained in params (v1) and p (v2), invalid JSON is counted as empty
+func CountConditions(params, p string) int {
+	var count func(value any, v2 bool) int
+	count = func(value any, v2 bool) int {
+		n := 0
+		switch v := value.(type) {
+		case []any:
+			if v2 {
+				return 1
+			}
+			for _, item := range v {
+				n += count(item, v2)
+			}
+		case map[string]any:
+			if _, ok := v["field"]; ok && !v2 {
+				return 1
+			}
+			for _, item := range v {
+				if v2 {
+					n += count(item, v2)
+				} else {
+					n++
+				}
+			}
+		case string:
+			if !v2 {
+				return 0
+			}
+			return 1
+		default:
+			return 1
+		}
+		return n
+	}
+	n := 0
+	var value any
+	if len(params) > 0 && json.Unmarshal([]byte(params), &value) == nil {
+		n += count(value, false)
+	}
+	value = nil
+	if len(p) > 0 && json.Unmarshal([]byte(p), &value) == nil {
+		n += count(value, true)
+	}
+	return n
+}
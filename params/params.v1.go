@@ -5,12 +5,13 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm/schema"
 )
 
-func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, params []interface{}, conds *Conditions, allowed map[string]struct{}) message.Message {
+func parseParams(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias string, params []interface{}, conds *Conditions, allowed map[string]struct{}) message.Message {
 	var operator string
 	for _, item := range params {
 		switch v := item.(type) {
@@ -23,11 +24,14 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 				// Structured parameter
 				var field string
 				if field, ok = rawField.(string); ok {
+					if !AllowedPath(modelSchema, field, FilterableFields) {
+						return message.FieldNotFilterable(c, field)
+					}
 					_, ok := allowed[field]
 					if allowed == nil || ok {
-						if parsedField, args, found := parseField(c, modelSchema, alias, field, conds.Nested); found {
+						if parsedField, args, typ := parseField(c, d, modelSchema, alias, field, conds.Nested); typ != nil {
 							conds.Args = append(conds.Args, args...)
-							err := parseStructuredParam(c, parsedField, v, operator, conds)
+							err := parseStructuredParam(c, parsedField, typ, v, operator, conds)
 							if err != nil {
 								return err
 							}
@@ -45,12 +49,15 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 					conds.Query += "("
 				}
 				for field, value := range v {
+					if !AllowedPath(modelSchema, field, FilterableFields) {
+						return message.FieldNotFilterable(c, field)
+					}
 					_, ok := allowed[field]
 					if allowed == nil || ok {
-						if parsedField, args, found := parseField(c, modelSchema, alias, field, conds.Nested); found {
+						if parsedField, args, typ := parseField(c, d, modelSchema, alias, field, conds.Nested); typ != nil {
 							conds.Args = append(conds.Args, args...)
 
-							parseDynamicParam(parsedField, value, operator, conds)
+							parseDynamicParam(c, parsedField, typ, value, operator, conds)
 						} else {
 							return message.InvalidField(c, field)
 						}
@@ -63,7 +70,7 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 		case []interface{}:
 			addOperator(&operator, &(*conds).Query)
 			conds.Query += "("
-			err := parseParams(c, modelSchema, alias, v, conds, allowed)
+			err := parseParams(c, d, modelSchema, alias, v, conds, allowed)
 			if err != nil {
 				return err
 			}
@@ -75,7 +82,7 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 	return nil
 }
 
-func parseField(c *gin.Context, modelSchema *schema.Schema, alias, key string, relations map[string]*Conditions) (string, []any, bool) {
+func parseField(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias, key string, relations map[string]*Conditions) (string, []any, reflect.Type) {
 	var field *schema.Field
 	var table string
 	if strings.Contains(key, ".") {
@@ -85,7 +92,7 @@ func parseField(c *gin.Context, modelSchema *schema.Schema, alias, key string, r
 			if ok {
 				modelSchema = rel.FieldSchema
 			} else {
-				return "", []any{}, false
+				return "", []any{}, nil
 			}
 		}
 		field = modelSchema.LookUpField(pieces[len(pieces)-1])
@@ -100,9 +107,9 @@ func parseField(c *gin.Context, modelSchema *schema.Schema, alias, key string, r
 		}
 	}
 	if field == nil {
-		return key, []any{}, false
+		return key, []any{}, nil
 	} else if alias, ok := field.Tag.Lookup("alias"); ok {
-		return alias, []any{}, true
+		return alias, []any{}, field.FieldType
 	} else if funcName, ok := field.StructField.Tag.Lookup("query"); ok {
 		if len(funcName) == 0 {
 			funcName = "Query" + field.Name
@@ -120,16 +127,16 @@ func parseField(c *gin.Context, modelSchema *schema.Schema, alias, key string, r
 			for rel := range rels {
 				relations[rel] = &Conditions{}
 			}
-			return sel, args, true
+			return sel, args, field.FieldType
 		} else {
-			return "", []any{}, false
+			return "", []any{}, nil
 		}
 	} else {
-		return table + "." + field.DBName, []any{}, true
+		return table + "." + d.Quote(field.DBName), []any{}, field.FieldType
 	}
 }
 
-func parseStructuredParam(c *gin.Context, field string, param map[string]interface{}, operator string, conds *Conditions) message.Message {
+func parseStructuredParam(c *gin.Context, field string, typ reflect.Type, param map[string]interface{}, operator string, conds *Conditions) message.Message {
 	addOperator(&operator, &(*conds).Query)
 	op, _ := param["operator"].(string)
 	conditionOperator := strings.ToUpper(strings.TrimSpace(op))
@@ -148,16 +155,19 @@ func parseStructuredParam(c *gin.Context, field string, param map[string]interfa
 		}
 	}
 	switch conditionOperator {
-	case "=", "!=", "<>", ">", "<", ">=", "<=", "LIKE":
+	case "LIKE":
 		conds.Query += field + " " + conditionOperator + " ?"
 		conds.Args = append(conds.Args, param["value"])
+	case "=", "!=", "<>", ">", "<", ">=", "<=":
+		conds.Query += field + " " + conditionOperator + " ?"
+		conds.Args = append(conds.Args, localizeDates(c, typ, param["value"]))
 	case "BETWEEN":
-		conds.Args = append(conds.Args, param["value"])
-		conds.Args = append(conds.Args, param["value2"])
+		conds.Args = append(conds.Args, localizeDates(c, typ, param["value"]))
+		conds.Args = append(conds.Args, localizeDates(c, typ, param["value2"]))
 		conds.Query += field + " " + conditionOperator + " ? AND ?"
 	case "IN", "NOT IN":
 		conds.Query += field + " " + conditionOperator + " (?)"
-		conds.Args = append(conds.Args, param["value"])
+		conds.Args = append(conds.Args, localizeDates(c, typ, param["value"]))
 	case "IS NULL", "IS NOT NULL":
 		conds.Query += field + " " + conditionOperator
 	default:
@@ -166,7 +176,7 @@ func parseStructuredParam(c *gin.Context, field string, param map[string]interfa
 	return nil
 }
 
-func parseDynamicParam(field string, value interface{}, operator string, conds *Conditions) {
+func parseDynamicParam(c *gin.Context, field string, typ reflect.Type, value interface{}, operator string, conds *Conditions) {
 	addOperator(&operator, &(*conds).Query)
 	var conditionOperator string
 	switch value.(type) {
@@ -176,7 +186,7 @@ func parseDynamicParam(field string, value interface{}, operator string, conds *
 		conditionOperator = "="
 	}
 	conds.Query += field + " " + conditionOperator + " ?"
-	conds.Args = append(conds.Args, value)
+	conds.Args = append(conds.Args, localizeDates(c, typ, value))
 }
 
 func addOperator(operator *string, stmt *string) {
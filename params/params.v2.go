@@ -5,24 +5,49 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/Datosystem/go_api_core/dialect"
 	"github.com/Datosystem/go_api_core/message"
 	"github.com/gin-gonic/gin"
 	"github.com/iancoleman/orderedmap"
 	"gorm.io/gorm/schema"
 )
 
-func parseParamsV2(c *gin.Context, modelSchema *schema.Schema, alias string, params *orderedmap.OrderedMap, conds *Conditions, allowed map[string]struct{}) message.Message {
+func parseParamsV2(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias string, params *orderedmap.OrderedMap, conds *Conditions, allowed map[string]struct{}) message.Message {
 	for _, key := range params.Keys() {
 		value, _ := params.Get(key)
 		logicOp := regexp.MustCompile(`^[|]+`).FindString(key)
 		condtionOp := regexp.MustCompile(`[!><%\-=]+$`).FindString(key)
-		if key[len(logicOp):][0] == '>' {
+		if key == "$having" {
+			v, ok := value.(orderedmap.OrderedMap)
+			if !ok {
+				return message.InvalidParamType(c, key, "object")
+			}
+			if conds.Type == "H" {
+				return message.InvalidField(c, key)
+			}
+			if conds.Having == nil {
+				// The relations used by the having conditions are joined with the other ones
+				if conds.Nested == nil {
+					conds.Nested = map[string]*Conditions{}
+				}
+				conds.Having = &Conditions{Type: "H", Nested: conds.Nested}
+			}
+			if err := parseParamsV2(c, d, modelSchema, alias, &v, conds.Having, allowed); err != nil {
+				return err
+			}
+		} else if key[len(logicOp):][0] == '>' {
+			if conds.Type == "H" {
+				return message.InvalidField(c, key)
+			}
 			dotIndex := strings.Index(key, ".")
 			if dotIndex == -1 {
 				return message.InvalidField(c, key)
 			}
 			remainder := logicOp + key[dotIndex+1:]
 			key = key[1+len(logicOp) : dotIndex]
+			if !AllowedPath(modelSchema, key, FilterableFields) {
+				return message.FieldNotFilterable(c, key)
+			}
 			rel, ok := modelSchema.Relationships.Relations[key]
 			if !ok {
 				continue
@@ -36,7 +61,7 @@ func parseParamsV2(c *gin.Context, modelSchema *schema.Schema, alias string, par
 			}
 			nested := orderedmap.New()
 			nested.Set(remainder, value)
-			if err := parseParamsV2(c, rel.FieldSchema, "", nested, conds.Nested[key], allowed); err != nil {
+			if err := parseParamsV2(c, d, rel.FieldSchema, "", nested, conds.Nested[key], allowed); err != nil {
 				return err
 			}
 		} else if v, ok := value.(orderedmap.OrderedMap); ok {
@@ -49,7 +74,7 @@ func parseParamsV2(c *gin.Context, modelSchema *schema.Schema, alias string, par
 				key = key[1:]
 				conds.Nested[key] = cond
 				if len(v.Keys()) > 0 {
-					if err := parseParamsV2(c, modelSchema, alias, &v, conds.Nested[key], allowed); err != nil {
+					if err := parseParamsV2(c, d, modelSchema, alias, &v, conds.Nested[key], allowed); err != nil {
 						return err
 					}
 				}
@@ -59,7 +84,7 @@ func parseParamsV2(c *gin.Context, modelSchema *schema.Schema, alias string, par
 					conds.Query += " NOT"
 				}
 				conds.Query += "(\n"
-				if err := parseParamsV2(c, modelSchema, alias, &v, conds, allowed); err != nil {
+				if err := parseParamsV2(c, d, modelSchema, alias, &v, conds, allowed); err != nil {
 					return err
 				}
 				conds.Query += "\n)"
@@ -67,12 +92,22 @@ func parseParamsV2(c *gin.Context, modelSchema *schema.Schema, alias string, par
 		} else {
 			addLogicOperator(logicOp, &(*conds).Query)
 			field := key[len(logicOp) : len(key)-len(condtionOp)]
+			path := field
+			if _, inner, ok := ParseAggregate(field); ok {
+				if conds.Type != "H" {
+					return message.AggregateOutsideHaving(c, field)
+				}
+				path = inner
+			}
+			if !AllowedPath(modelSchema, path, FilterableFields) {
+				return message.FieldNotFilterable(c, field)
+			}
 			_, ok := allowed[field]
 			if allowed == nil || ok {
 				if conds.Nested == nil {
 					conds.Nested = map[string]*Conditions{}
 				}
-				if err := addCondition(c, modelSchema, alias, condtionOp, field, value, conds, conds.Nested); err != nil {
+				if err := addCondition(c, d, modelSchema, alias, condtionOp, field, value, conds, conds.Nested); err != nil {
 					return err
 				}
 			}
@@ -91,13 +126,13 @@ func addLogicOperator(ops string, stmt *string) {
 	}
 }
 
-func addCondition(c *gin.Context, modelSchema *schema.Schema, alias, ops string, key string, value interface{}, conds *Conditions, relations map[string]*Conditions) message.Message {
-	if field, args, typ := parseFieldV2(c, modelSchema, alias, key, relations); typ != nil {
-		conds.Query += " " + field
-		conds.Args = append(conds.Args, args...)
-	} else {
+func addCondition(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias, ops string, key string, value interface{}, conds *Conditions, relations map[string]*Conditions) message.Message {
+	field, args, typ := parseFieldV2(c, d, modelSchema, alias, key, relations)
+	if typ == nil {
 		return message.InvalidField(c, key)
 	}
+	conds.Query += " " + field
+	conds.Args = append(conds.Args, args...)
 
 	var operator string
 	if strings.Contains(ops, "><") {
@@ -107,7 +142,7 @@ func addCondition(c *gin.Context, modelSchema *schema.Schema, alias, ops string,
 		}
 		operator += " BETWEEN ? AND ?"
 		if slice, ok := value.([]interface{}); ok {
-			conds.Args = append(conds.Args, slice[0], slice[1])
+			conds.Args = append(conds.Args, localizeDates(c, typ, slice[0]), localizeDates(c, typ, slice[1]))
 		} else {
 			return message.InvalidParamType(c, key, "[]string")
 		}
@@ -162,14 +197,26 @@ func addCondition(c *gin.Context, modelSchema *schema.Schema, alias, ops string,
 			}
 		}
 
-		conds.Args = append(conds.Args, value)
+		if strings.Contains(ops, "%") {
+			conds.Args = append(conds.Args, value)
+		} else {
+			conds.Args = append(conds.Args, localizeDates(c, typ, value))
+		}
 	}
 
 	conds.Query += operator
 	return nil
 }
 
-func parseFieldV2(c *gin.Context, modelSchema *schema.Schema, alias, key string, relations map[string]*Conditions) (string, []any, reflect.Type) {
+func parseFieldV2(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias, key string, relations map[string]*Conditions) (string, []any, reflect.Type) {
+	if fn, inner, ok := ParseAggregate(key); ok {
+		field, args, typ := parseFieldV2(c, d, modelSchema, alias, inner, relations)
+		if typ == nil {
+			return field, args, nil
+		}
+		return AggregateToSql(fn, field), args, typ
+	}
+
 	var field *schema.Field
 	var table string
 	if strings.Contains(key, ".") {
@@ -228,6 +275,6 @@ func parseFieldV2(c *gin.Context, modelSchema *schema.Schema, alias, key string,
 			return "", []any{}, nil
 		}
 	} else {
-		return table + "." + field.DBName, []any{}, field.FieldType
+		return table + "." + d.Quote(field.DBName), []any{}, field.FieldType
 	}
 }
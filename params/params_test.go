@@ -0,0 +1,58 @@
+package params
+
+import "testing"
+
+func TestParseAggregate(t *testing.T) {
+	tests := []struct {
+		field string
+		fn    string
+		inner string
+		ok    bool
+	}{
+		{"SUM(AMOUNT)", "SUM", "AMOUNT", true},
+		{"AVG( AMOUNT )", "AVG", "AMOUNT", true},
+		{"MIN(Customer.NAME)", "MIN", "Customer.NAME", true},
+		{"MAX(DATE)", "MAX", "DATE", true},
+		{"COUNT(ID)", "COUNT", "ID", true},
+		{"COUNT(DISTINCT CUSTOMER_ID)", CountDistinct, "CUSTOMER_ID", true},
+		{"AMOUNT", "", "", false},
+		{"SUM(AMOUNT", "", "", false},
+		{"sum(AMOUNT)", "", "", false},
+		{"TOTAL(AMOUNT)", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			fn, inner, ok := ParseAggregate(tt.field)
+			if fn != tt.fn || inner != tt.inner || ok != tt.ok {
+				t.Errorf("got (%q, %q, %v), want (%q, %q, %v)", fn, inner, ok, tt.fn, tt.inner, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCountConditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		p      string
+		count  int
+	}{
+		{"empty", "", "", 0},
+		{"v1 condition", `{"field":"ID","operator":"=","value":1}`, "", 1},
+		{"v1 list", `[{"field":"ID","value":1},{"field":"NAME","value":"a"}]`, "", 2},
+		{"v1 nested", `[{"field":"ID","value":1},[{"field":"NAME","value":"a"},{"field":"CODE","value":2}]]`, "", 3},
+		{"v1 map", `{"ID":1,"NAME":"a"}`, "", 2},
+		{"v2 fields", "", `{"ID":1,"NAME>":"a"}`, 2},
+		{"v2 list value", "", `{"ID":[1,2,3]}`, 1},
+		{"v2 groups", "", `{"$or":{"ID":1,"NAME":"a"},"CODE":2}`, 3},
+		{"both", `{"ID":1}`, `{"NAME":"a"}`, 2},
+		{"invalid JSON", `{"ID":`, `{"NAME":"a"}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountConditions(tt.params, tt.p); got != tt.count {
+				t.Errorf("got %d, want %d", got, tt.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package params
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/Datosystem/go_api_core/dialect"
+	"github.com/Datosystem/go_api_core/message"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/schema"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`)
+
+// SearchFields returns the fields used by the search: the fields tagged with search, query fields included,
+// and for the relations tagged with search:"FIELD1,FIELD2" the listed fields of the related model (eg. Customer.NAME).
+// The has many and many to many relations are ignored, joining them would repeat the rows of the model.
+func SearchFields(modelSchema *schema.Schema) []string {
+	fields := []string{}
+	for _, field := range modelSchema.Fields {
+		tag, ok := field.Tag.Lookup("search")
+		if !ok {
+			continue
+		}
+		if rel, ok := modelSchema.Relationships.Relations[field.Name]; ok {
+			if rel.Type == schema.HasMany || rel.Type == schema.Many2Many {
+				continue
+			}
+			for _, name := range strings.Split(tag, ",") {
+				if name = strings.TrimSpace(name); len(name) > 0 {
+					fields = append(fields, field.Name+"."+name)
+				}
+			}
+		} else {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// SearchWords splits the search in words, the text between double quotes is kept as a single word
+func SearchWords(q string) []string {
+	words := []string{}
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if part = strings.TrimSpace(part); len(part) > 0 {
+				words = append(words, part)
+			}
+		} else {
+			words = append(words, strings.Fields(part)...)
+		}
+	}
+	return words
+}
+
+/*
+Search adds to the conditions the search of the words of q in the SearchFields of the model:
+every word must be contained (case insensitive) in at least one of the fields.
+With rank the number of matches of the words in the fields is set in conds.Rank, to order the results by relevance.
+*/
+func Search(c *gin.Context, d dialect.Dialect, modelSchema *schema.Schema, alias, q string, rank bool, conds *Conditions) message.Message {
+	words := SearchWords(q)
+	if len(words) == 0 {
+		return nil
+	}
+	fields := SearchFields(modelSchema)
+	if len(fields) == 0 {
+		return message.SearchNotSupported(c)
+	}
+	if conds.Nested == nil {
+		conds.Nested = map[string]*Conditions{}
+	}
+
+	exprs := make([]string, len(fields))
+	exprArgs := make([][]any, len(fields))
+	for i, field := range fields {
+		expr, args, typ := parseFieldV2(c, d, modelSchema, alias, field, conds.Nested)
+		if typ == nil {
+			return message.InvalidField(c, field)
+		}
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.String {
+			expr = d.CastText(expr)
+		}
+		exprs[i] = "LOWER(" + expr + ") LIKE LOWER(?) ESCAPE '\\'"
+		exprArgs[i] = args
+	}
+
+	var rankExprs []string
+	var rankArgs []any
+	wordConds := make([]string, len(words))
+	for w, word := range words {
+		pattern := "%" + likeEscaper.Replace(word) + "%"
+		for i, expr := range exprs {
+			conds.Args = append(append(conds.Args, exprArgs[i]...), pattern)
+			if rank {
+				rankExprs = append(rankExprs, "CASE WHEN "+expr+" THEN 1 ELSE 0 END")
+				rankArgs = append(append(rankArgs, exprArgs[i]...), pattern)
+			}
+		}
+		wordConds[w] = "(" + strings.Join(exprs, " OR ") + ")"
+	}
+	if len(conds.Query) > 0 {
+		conds.Query = "(" + conds.Query + ") AND " + strings.Join(wordConds, " AND ")
+	} else {
+		conds.Query = strings.Join(wordConds, " AND ")
+	}
+	if rank {
+		conds.Rank = &Conditions{Query: strings.Join(rankExprs, " + "), Args: rankArgs}
+	}
+	return nil
+}
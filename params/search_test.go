@@ -0,0 +1,66 @@
+package params
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestSearchWords(t *testing.T) {
+	tests := []struct {
+		q     string
+		words []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"red car", []string{"red", "car"}},
+		{"  red \t car  ", []string{"red", "car"}},
+		{`"red car" fast`, []string{"red car", "fast"}},
+		{`fast " red  car "`, []string{"fast", "red  car"}},
+		{`""`, []string{}},
+		{`unclosed "red car`, []string{"unclosed", "red car"}},
+		{`a"b"c`, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			if got := SearchWords(tt.q); !reflect.DeepEqual(got, tt.words) {
+				t.Errorf("got %q, want %q", got, tt.words)
+			}
+		})
+	}
+}
+
+type testSearchCustomer struct {
+	ID     int               `gorm:"primaryKey"`
+	NAME   string            `search:""`
+	Orders []testSearchOrder `gorm:"foreignKey:CUSTOMER_ID" search:"NOTE"`
+}
+
+type testSearchOrder struct {
+	ID          int `gorm:"primaryKey"`
+	CUSTOMER_ID int
+	NOTE        string              `search:""`
+	Customer    *testSearchCustomer `gorm:"foreignKey:CUSTOMER_ID" search:"NAME"`
+}
+
+func TestSearchFields(t *testing.T) {
+	tests := []struct {
+		model  any
+		fields []string
+	}{
+		// The orders would repeat the customers
+		{&testSearchCustomer{}, []string{"NAME"}},
+		{&testSearchOrder{}, []string{"NOTE", "Customer.NAME"}},
+	}
+	for _, tt := range tests {
+		modelSchema, err := schema.Parse(tt.model, &sync.Map{}, schema.NamingStrategy{NoLowerCase: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := SearchFields(modelSchema); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: got %v, want %v", modelSchema.Name, got, tt.fields)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package params
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/Datosystem/go_api_core/datatypes"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	datetimeType    = reflect.TypeOf(datatypes.Datetime{})
+	timeType        = reflect.TypeOf(time.Time{})
+	datetimeLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04", "2006-01-02 15:04"}
+)
+
+/*
+localizeDates parses the datetime literals compared with a datetime field (values of IN included): the ones without
+an offset are in the time zone of the request (see app.RequestLocation) and are converted to datatypes.Datetime, so that
+they're bound in datatypes.StorageLocation. Dates, the other values and every value of the requests without a time zone
+are returned unchanged.
+*/
+func localizeDates(c *gin.Context, typ reflect.Type, value any) any {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ != datetimeType && typ != timeType {
+		return value
+	}
+	loc := app.RequestLocation(c)
+	if loc == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case []any:
+		values := make([]any, len(v))
+		for i := range v {
+			values[i] = localizeDates(c, typ, v[i])
+		}
+		return values
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return datatypes.Datetime(t)
+		}
+		for _, layout := range datetimeLayouts {
+			if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+				return datatypes.Datetime(t)
+			}
+		}
+	}
+	return value
+}
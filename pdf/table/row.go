@@ -5,6 +5,9 @@ import (
 	"math"
 	"reflect"
 	"strings"
+	"time"
+
+	"github.com/Datosystem/go_api_core/datatypes"
 )
 
 type Row struct {
@@ -72,7 +75,18 @@ func (r *Row) Add(value any, styles ...*Style) {
 				value = rv.Elem().Interface()
 			}
 		}
-		str = fmt.Sprintf("%v", value)
+		switch v := value.(type) {
+		case datatypes.Datetime:
+			loc := r.table.location
+			if loc == nil {
+				loc = time.UTC
+			}
+			str = time.Time(v).In(loc).Format("02/01/2006 15:04")
+		case datatypes.Date:
+			str = time.Time(v).Format("02/01/2006")
+		default:
+			str = fmt.Sprintf("%v", value)
+		}
 		if len(style.Format) > 0 {
 			if style.Format == "-" {
 				r.table.pdf.SetFontStyle("")
@@ -2,7 +2,10 @@ package table
 
 import (
 	"strings"
+	"time"
 
+	"github.com/Datosystem/go_api_core/app"
+	"github.com/gin-gonic/gin"
 	"github.com/phpdave11/gofpdf"
 	"golang.org/x/net/html"
 )
@@ -17,6 +20,7 @@ type Table struct {
 	headerFunc  func()
 	footerFunc  func()
 	onPageBreak func()
+	location    *time.Location
 }
 
 // Calls the tableHeader method if exists
@@ -169,6 +173,12 @@ func (t *Table) SetRowHeight(rowHeight float64) *Table {
 	return t
 }
 
+// Sets the time zone of the datetimes added to the table, UTC if not set (see NewForRequest)
+func (t *Table) SetLocation(loc *time.Location) *Table {
+	t.location = loc
+	return t
+}
+
 // Add the specified value and style
 func (t *Table) Add(value any, styles ...*Style) *Table {
 	t.row.Add(value, styles...)
@@ -463,6 +473,11 @@ func (t *Table) Hr() *Table {
 	return t
 }
 
+// NewForRequest returns a new table whose datetimes are in the time zone of the request (see app.RequestLocation)
+func NewForRequest(c *gin.Context, p *gofpdf.Fpdf, x1 float64, x2 float64) *Table {
+	return New(p, x1, x2).SetLocation(app.RequestLocation(c))
+}
+
 func New(p *gofpdf.Fpdf, x1 float64, x2 float64) *Table {
 	return &Table{pdf: p, startX: x1, endX: x2}
 }
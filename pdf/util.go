@@ -7,8 +7,11 @@ import (
 	"os"
 	"path"
 	"sync"
+	"time"
 
+	"github.com/Datosystem/go_api_core/app"
 	"github.com/Datosystem/go_api_core/controller"
+	"github.com/Datosystem/go_api_core/datatypes"
 	"github.com/gin-gonic/gin"
 	"github.com/phpdave11/gofpdf"
 )
@@ -53,3 +56,12 @@ func Box(p *gofpdf.Fpdf, x, y, w, h float64, styleStr string, checked bool) {
 		p.Line(x, y+h, x+w, y)
 	}
 }
+
+// FormatDatetime formats the datetime in the time zone of the request (see app.RequestLocation), UTC if not set
+func FormatDatetime(c *gin.Context, datetime datatypes.Datetime, layout string) string {
+	loc := app.RequestLocation(c)
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.Time(datetime).In(loc).Format(layout)
+}
@@ -0,0 +1,261 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Styles indexes, see stylesXml
+const (
+	styleDefault = iota
+	styleDate
+	styleDatetime
+)
+
+// Date is written as a date without the time part
+type Date time.Time
+
+type Workbook struct {
+	sheets []*Sheet
+	names  map[string]struct{}
+}
+
+type Sheet struct {
+	Name string
+	rows [][]any
+}
+
+func New() *Workbook {
+	return &Workbook{names: map[string]struct{}{}}
+}
+
+// AddSheet adds a new sheet, the name is sanitized and made unique as required by Excel
+func (w *Workbook) AddSheet(name string) *Sheet {
+	name = strings.NewReplacer("[", "", "]", "", ":", "", "*", "", "?", "", "/", "", "\\", "").Replace(name)
+	if len(name) == 0 {
+		name = "Sheet"
+	}
+	// The limit counts characters, the names are truncated by runes to keep them valid UTF-8
+	runes := []rune(name)
+	if len(runes) > 31 {
+		runes = runes[:31]
+		name = string(runes)
+	}
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := w.names[strings.ToLower(unique)]; !ok {
+			break
+		}
+		suffix := " (" + strconv.Itoa(i) + ")"
+		if len(runes)+len(suffix) > 31 {
+			unique = string(runes[:31-len(suffix)]) + suffix
+		} else {
+			unique = name + suffix
+		}
+	}
+	w.names[strings.ToLower(unique)] = struct{}{}
+	sheet := &Sheet{Name: unique}
+	w.sheets = append(w.sheets, sheet)
+	return sheet
+}
+
+// AddRow appends a row to the sheet. Supported values are strings, booleans, numbers, time.Time and Date;
+// nil values produce empty cells while other types are written with fmt.Sprint
+func (s *Sheet) AddRow(values ...any) {
+	s.rows = append(s.rows, values)
+}
+
+// Write writes the workbook to the writer in the xlsx (Office Open XML) format
+func (w *Workbook) Write(wr io.Writer) error {
+	if len(w.sheets) == 0 {
+		w.AddSheet("Sheet1")
+	}
+	z := zip.NewWriter(wr)
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range w.sheets {
+		n := strconv.Itoa(i + 1)
+		contentTypes.WriteString(`<Override PartName="/xl/worksheets/sheet` + n + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="` + escape(sheet.Name) + `" sheetId="` + n + `" r:id="rId` + n + `"/>`)
+		workbookRels.WriteString(`<Relationship Id="rId` + n + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + n + `.xml"/>`)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`<Relationship Id="rId` + strconv.Itoa(len(w.sheets)+1) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", stylesXml},
+	}
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	for i, sheet := range w.sheets {
+		fw, err := z.Create("xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml")
+		if err != nil {
+			return err
+		}
+		if err := sheet.write(fw); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func (s *Sheet) write(wr io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range s.rows {
+		r := strconv.Itoa(i + 1)
+		b.WriteString(`<row r="` + r + `">`)
+		for j, val := range row {
+			b.WriteString(cell(columnName(j)+r, val))
+		}
+		b.WriteString(`</row>`)
+		// Flushes the buffer periodically to keep it small
+		if b.Len() > 1<<16 {
+			if _, err := io.WriteString(wr, b.String()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(wr, b.String())
+	return err
+}
+
+func cell(ref string, val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case Date:
+		t := time.Time(v)
+		if t.IsZero() {
+			return ""
+		}
+		return numberCell(ref, styleDate, serial(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)))
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return numberCell(ref, styleDatetime, serial(v))
+	case fmt.Stringer:
+		return stringCell(ref, v.String())
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return cell(ref, v.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return `<c r="` + ref + `"><v>` + strconv.FormatInt(v.Int(), 10) + `</v></c>`
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return `<c r="` + ref + `"><v>` + strconv.FormatUint(v.Uint(), 10) + `</v></c>`
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return ""
+		}
+		return `<c r="` + ref + `"><v>` + strconv.FormatFloat(f, 'f', -1, v.Type().Bits()) + `</v></c>`
+	case reflect.Bool:
+		b := "0"
+		if v.Bool() {
+			b = "1"
+		}
+		return `<c r="` + ref + `" t="b"><v>` + b + `</v></c>`
+	case reflect.String:
+		return stringCell(ref, v.String())
+	}
+	return stringCell(ref, fmt.Sprint(val))
+}
+
+func numberCell(ref string, style int, val float64) string {
+	s := ""
+	if style != styleDefault {
+		s = ` s="` + strconv.Itoa(style) + `"`
+	}
+	return `<c r="` + ref + `"` + s + `><v>` + strconv.FormatFloat(val, 'f', -1, 64) + `</v></c>`
+}
+
+func stringCell(ref, val string) string {
+	if len(val) == 0 {
+		return ""
+	}
+	return `<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">` + escape(val) + `</t></is></c>`
+}
+
+// serial converts the wall clock of the time to the Excel serial date
+func serial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		// Control characters aren't allowed in xml 1.0
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			continue
+		}
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			b.WriteString("&quot;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+const stylesXml = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/><numFmt numFmtId="165" formatCode="dd/mm/yyyy hh:mm"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
@@ -0,0 +1,132 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		name  string
+	}{{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"}}
+	for _, tt := range tests {
+		if got := columnName(tt.index); got != tt.name {
+			t.Errorf("column %d: got %s, want %s", tt.index, got, tt.name)
+		}
+	}
+}
+
+func TestAddSheet(t *testing.T) {
+	w := New()
+	long := strings.Repeat("x", 40)
+	accented := strings.Repeat("è", 40)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Orders", "Orders"},
+		{"orders", "orders (2)"},
+		{"Orders", "Orders (3)"},
+		{"a/b:[c]*?", "abc"},
+		{"", "Sheet"},
+		{long, long[:31]},
+		{long, long[:27] + " (2)"},
+		{accented, strings.Repeat("è", 31)},
+		{accented, strings.Repeat("è", 27) + " (2)"},
+	}
+	for _, tt := range tests {
+		if got := w.AddSheet(tt.name).Name; got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCell(t *testing.T) {
+	n := 5
+	var nilPtr *int
+	tests := []struct {
+		name  string
+		value any
+		cell  string
+	}{
+		{"nil", nil, ``},
+		{"nil pointer", nilPtr, ``},
+		{"int", 42, `<c r="A1"><v>42</v></c>`},
+		{"pointer", &n, `<c r="A1"><v>5</v></c>`},
+		{"uint", uint8(7), `<c r="A1"><v>7</v></c>`},
+		{"float", 1.5, `<c r="A1"><v>1.5</v></c>`},
+		{"float32", float32(0.1), `<c r="A1"><v>0.1</v></c>`},
+		{"bool", true, `<c r="A1" t="b"><v>1</v></c>`},
+		{"string", "a<b & c", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">a&lt;b &amp; c</t></is></c>`},
+		{"empty string", "", ``},
+		{"control characters", "a\x00b", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">ab</t></is></c>`},
+		{"date", Date(time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)), `<c r="A1" s="1"><v>45352</v></c>`},
+		{"datetime", time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC), `<c r="A1" s="2"><v>45352.75</v></c>`},
+		{"zero time", time.Time{}, ``},
+		{"other", []int{1, 2}, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">[1 2]</t></is></c>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cell("A1", tt.value); got != tt.cell {
+				t.Errorf("got %s, want %s", got, tt.cell)
+			}
+		})
+	}
+}
+
+// The written workbook must be a zip of well formed parts, with a worksheet for each sheet
+func TestWrite(t *testing.T) {
+	w := New()
+	sheet := w.AddSheet("Orders")
+	sheet.AddRow("ID", "AMOUNT")
+	sheet.AddRow(1, 10.5)
+	w.AddSheet("Customers").AddRow("NAME")
+
+	var buf bytes.Buffer
+	if err := w.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d := xml.NewDecoder(bytes.NewReader(data)); ; {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s: %v", f.Name, err)
+				break
+			}
+		}
+		parts[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Customers" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("missing sheet Customers in %s", parts["xl/workbook.xml"])
+	}
+	if want := `<row r="2"><c r="A2"><v>1</v></c><c r="B2"><v>10.5</v></c></row>`; !strings.Contains(parts["xl/worksheets/sheet1.xml"], want) {
+		t.Errorf("missing %s in %s", want, parts["xl/worksheets/sheet1.xml"])
+	}
+}